@@ -7,18 +7,13 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/akamensky/argparse"
 	"github.com/arrivance/telenamer/telelib"
 )
 
-// FileRenames are error prone operations, and we're performing it in a GoRoutine, so we
-// ensure we have a way of reporting errors.
-type fileRenameErr struct {
-	FileRename telelib.FileRename
-	Error      error
-}
-
 func main() {
 	/**
 		Preps the environment for the CLI to function as intended.
@@ -36,13 +31,54 @@ func main() {
 			{n} = episode name 
 			{z}/{0z} = series number {0z} prepends a 0 if the series number is less than 10
 			{e}/{0e} = episode number. {0e} prepends a 0 if the episode number is less than 10 
+			{le}/{0le} = last episode number of a multi-episode file
+			{m} = -E{0le} for multi-episode files, and nothing otherwise
+			{lang}/{subflags} = language (e.g. en) and flags (e.g. sdh.forced) of subtitles. Added to the end of
+			subtitle names if the format has neither.
+			Folders can be created with /, e.g. {s}/Season {0z}/{s} - S{0z}E{0e} - {n}
 			Default format: {s} - S{0z}E{0e} - {n}`,
 			Default: "{s} - S{0z}E{0e} - {n}",
 		})
+	preset := parser.Selector("", "preset", telelib.PresetNames(), &argparse.Options{Required: false, Help: "Use a media server's naming conventions instead of --format"})
+	sanitize := parser.Selector("", "sanitize", telelib.SanitizePolicies, &argparse.Options{Required: false, Help: "Characters and names to clean from file names: windows, posix or portable/smb", Default: "windows"})
+	maxLength := parser.Int("", "max-length", &argparse.Options{Required: false, Help: "Maximum length of a file name in bytes, at least 32. Episode names are shortened first.", Default: telelib.DefaultMaxLength})
+	normalize := parser.Selector("", "normalize", telelib.Normalizations, &argparse.Options{Required: false, Help: "Unicode normalization form for series and episode names", Default: "none"})
+	ascii := parser.Flag("", "ascii", &argparse.Options{Required: false, Help: "Transliterate series and episode names to ASCII (e.g. Pokémon to Pokemon)"})
+	replace := parser.List("", "replace", &argparse.Options{Required: false, Help: "Replace text in series and episode names, as from=to (e.g. \":= -\"). Can be repeated."})
 	series := parser.String("s", "series", &argparse.Options{Required: false, Help: "Name of series (if not provided, retrieved from file name.)"})
 	confirm := parser.Flag("c", "confirm", &argparse.Options{Required: false, Help: "Manually confirm all name changes"})
 	silent := parser.Flag("z", "silent", &argparse.Options{Required: false, Help: "Silent mode (does not work with -c)"})
-	undo := parser.Flag("u", "undo", &argparse.Options{Required: false, Help: "Undos previous filenames (assuming you are in the same directory), and exits."})
+	undo := parser.Flag("u", "undo", &argparse.Options{Required: false, Help: "Undos the last operation performed in the current directory, and exits."})
+	undoLast := parser.Int("", "undo-last", &argparse.Options{Required: false, Help: "Undos the last N operations performed in the current directory, newest first, and exits."})
+	undoID := parser.String("", "undo-id", &argparse.Options{Required: false, Help: "Undos the operation with the given ID (see --history), and exits."})
+	showHistory := parser.Flag("", "history", &argparse.Options{Required: false, Help: "Lists the operations performed in the current directory that can be undone, newest first, and exits."})
+	recovery := parser.Flag("", "recover", &argparse.Options{Required: false, Help: "Works out which renames interrupted operations in the current directory performed, so they can be undone, and exits."})
+	preview := parser.Flag("", "preview", &argparse.Options{Required: false, Help: "Prints what the format produces for sample episode information, without renaming anything, and exits."})
+	sample := parser.List("", "sample", &argparse.Options{Required: false, Help: "Episode information to preview with, as key=value (series, name, season, episode, lastepisode, container, lang, subflags). Can be repeated."})
+	dryRun := parser.Flag("", "dry-run", &argparse.Options{Required: false, Help: "Looks up every file and prints the renames that would be performed, without renaming anything. Exits with 1 if any file would fail."})
+	jsonOutput := parser.Flag("", "json", &argparse.Options{Required: false, Help: "Print the --dry-run plan as JSON"})
+	onCollision := parser.Selector("", "on-collision", telelib.CollisionPolicies, &argparse.Options{Required: false, Help: "What to do when a file would overwrite another: fail, skip, suffix (keeps both, adding (2)), best (keeps the higher resolution/larger file) or quarantine (keeps the best, and moves the other to --quarantine-dir)", Default: "skip"})
+	quarantineDir := parser.String("", "quarantine-dir", &argparse.Options{Required: false, Help: "Where --on-collision quarantine moves the worse copy of a file. Relative to the file's folder, unless absolute.", Default: telelib.DefaultQuarantineDir})
+	compareHash := parser.Flag("", "compare-hash", &argparse.Options{Required: false, Help: "Compare the contents of colliding files, so identical copies are never kept over the existing file"})
+	actionName := parser.Selector("", "action", telelib.Actions, &argparse.Options{Required: false, Help: "How files end up at their new names: rename, move, copy, hardlink, symlink or reflink (copy-on-write, where supported)", Default: "rename"})
+	seasonFolderFormat := parser.String("", "season-folder-format", &argparse.Options{Required: false, Help: "Also rename folders holding a single season of a series, e.g. \"Season {0z}\". Can use {s}, {z} and {0z}."})
+	seriesFolderFormat := parser.String("", "series-folder-format", &argparse.Options{Required: false, Help: "Also rename folders holding a series, either directly or within season folders, e.g. \"{s}\". Can only use {s}."})
+	dest := parser.String("", "dest", &argparse.Options{Required: false, Help: "Folder to put every renamed file in (e.g. a library), instead of next to the original"})
+	atomic := parser.Flag("", "atomic", &argparse.Options{Required: false, Help: "All-or-nothing renames: if any rename fails, every rename already performed is rolled back"})
+	savePlan := parser.String("", "save-plan", &argparse.Options{Required: false, Help: "Writes the --dry-run plan to a JSON file, or YAML if the name ends in .yaml or .yml, which can be edited and applied later with --apply-plan."})
+	applyPlan := parser.String("", "apply-plan", &argparse.Options{Required: false, Help: "Applies a JSON or YAML plan written by --save-plan, if none of its files have changed, and exits."})
+	previewFiles := parser.Flag("", "preview-files", &argparse.Options{Required: false, Help: "Preview against the files in --path, using information from their file names."})
+	paths := parser.List("p", "path", &argparse.Options{Required: false, Help: "Folder or file to rename episodes in, instead of the current directory. Can be repeated."})
+	noCompanions := parser.Flag("", "no-companions", &argparse.Options{Required: false, Help: "Don't rename subtitles, .nfo files and artwork that share a video's name along with it"})
+	recursive := parser.Flag("r", "recursive", &argparse.Options{Required: false, Help: "Rename episodes in every folder within --path as well. Files stay in their own folder, unless the format has folders."})
+	maxDepth := parser.Int("", "max-depth", &argparse.Options{Required: false, Help: "How many folders deep --recursive looks, e.g. 1 for only the folders directly within --path. 0 has no limit.", Default: 0})
+	exclude := parser.List("", "exclude", &argparse.Options{Required: false, Help: "Skip files, and folders when --recursive, matching a glob (e.g. \"Extras\" or \"*.part\"). Can be repeated."})
+	allow := parser.List("", "allow", &argparse.Options{Required: false, Help: "Only rename episodes with this extension (e.g. mkv), treating it as a video even if its name doesn't say so. Can be repeated."})
+	deny := parser.List("", "deny", &argparse.Options{Required: false, Help: "Never rename files with this extension (e.g. txt), not even along with a video. Can be repeated."})
+	minSize := parser.Int("", "min-size", &argparse.Options{Required: false, Help: "Skip episodes smaller than this many megabytes, such as previews", Default: 0})
+	skipSamples := parser.Flag("", "skip-samples", &argparse.Options{Required: false, Help: "Skip episodes with \"sample\" in their name"})
+	skipFormatted := parser.Flag("", "skip-formatted", &argparse.Options{Required: false, Help: "Skip episodes that look like they have already been named with the format, without looking them up"})
+	verbose := parser.Flag("v", "verbose", &argparse.Options{Required: false, Help: "Log every file that is skipped, and why"})
 
 	// Authentication parameters
 	username := parser.String("n", "username", &argparse.Options{Required: false, Help: "TVDB Username"})
@@ -64,12 +100,131 @@ func main() {
 		log.SetOutput(ioutil.Discard)
 	}
 
-	if *undo {
-		undoRenames()
+	if *undo || *undoLast > 0 || *undoID != "" {
+		count := *undoLast
+		if count == 0 {
+			count = 1
+		}
+		undoRenames(*undoID, count)
 		// Having multiple operations with undo just seems, excessive.
 		os.Exit(0)
 	}
 
+	if *showHistory {
+		listHistory()
+		os.Exit(0)
+	}
+
+	if *recovery {
+		history := renameHistory()
+		ops, err := history.Operations(currentDirectory())
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, v := range ops {
+			completed, unresolved := recoverOperation(history, v)
+			log.Print(fmt.Sprintf("Operation %v: recovered %v renames that can be undone, %v need checking by hand", v.ID, len(completed), len(unresolved)))
+		}
+		os.Exit(0)
+	}
+
+	collisionOptions := telelib.CollisionOptions{QuarantineDir: *quarantineDir, CompareHash: *compareHash}
+	collisionOptions.Policy, err = telelib.ParseCollisionPolicy(*onCollision)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	applyOptions := telelib.ApplyOptions{Atomic: *atomic, Progress: progressLogger()}
+
+	if *applyPlan != "" {
+		applySavedPlan(*applyPlan, collisionOptions, applyOptions)
+		os.Exit(0)
+	}
+
+	var namingOptions telelib.NamingOptions
+	namingOptions.Sanitize, err = telelib.ParseSanitizePolicy(*sanitize)
+	if err != nil {
+		log.Fatal(err)
+	}
+	namingOptions.Replacements, err = telelib.ParseReplacements(*replace)
+	if err != nil {
+		log.Fatal(err)
+	}
+	namingOptions.MaxLength = *maxLength
+	if err := namingOptions.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	namingOptions.Normalize, err = telelib.ParseNormalization(*normalize)
+	if err != nil {
+		log.Fatal(err)
+	}
+	namingOptions.Transliterate = *ascii
+	namingOptions.DestDir = *dest
+
+	action, err := telelib.ParseAction(*actionName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Catch typos in the format before anything is looked up or renamed.
+	if *preset == "" {
+		if err := telelib.ValidateFormat(*format); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	folderOptions := telelib.FolderOptions{SeasonFormat: *seasonFolderFormat, SeriesFormat: *seriesFolderFormat, Naming: namingOptions}
+	if err := folderOptions.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	// Renaming the folder of a copy or link would take the original along with it.
+	if (folderOptions.SeasonFormat != "" || folderOptions.SeriesFormat != "") && !action.Moves() {
+		log.Fatal("Folders can only be renamed along with --action rename or move")
+	}
+
+	var mediaPreset *telelib.Preset
+	if *preset != "" {
+		found, err := telelib.GetPreset(*preset)
+		if err != nil {
+			log.Fatal(err)
+		}
+		mediaPreset = &found
+	}
+
+	// Formats with folders create them within the folder each file was found in, so files found by walking
+	// subfolders are brought together rather than nested further.
+	newNamer := func(baseDir string) telelib.Namer {
+		opts := namingOptions
+		opts.BaseDir = baseDir
+		if mediaPreset != nil {
+			return telelib.PresetNamer(*mediaPreset, opts)
+		}
+		return telelib.FormatNamer(*format, opts)
+	}
+
+	source := fileSource{paths: *paths, recursive: *recursive, walk: telelib.WalkOptions{MaxDepth: *maxDepth, Exclude: *exclude}}
+	source.filter = telelib.FileFilter{Allow: *allow, Deny: *deny, Exclude: *exclude, MinSize: int64(*minSize) << 20, SkipSamples: *skipSamples}
+	if err := source.filter.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if *skipFormatted {
+		formats := []string{*format}
+		if mediaPreset != nil {
+			formats = []string{mediaPreset.Format, mediaPreset.SpecialsFormat}
+		}
+		matcher, err := telelib.NewFormatMatcher(formats...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		source.filter.Formatted = &matcher
+	}
+
+	if *preview {
+		previewFormat(newNamer, *sample, *previewFiles, source, *series)
+		// Previews never rename anything, so there is nothing else to do.
+		os.Exit(0)
+	}
+
 	var login telelib.TVDBLogin
 	var path string
 
@@ -77,7 +232,7 @@ func main() {
 	// 1) Command line
 	// 2) Direct path to file provided in command line
 	// 3) Environment variables
-	// 4) login.json in same directory as executable.
+	// 4) login.json in the configuration folder (see loginPath).
 	if *username != "" && *userkey != "" && *apikey != "" {
 		login = telelib.TVDBLogin{
 			Username: *username,
@@ -93,12 +248,7 @@ func main() {
 			Apikey:   os.Getenv("tvdb_apikey"),
 		}
 	} else {
-		// Find the directory the executable is within.
-		ex, err := os.Executable()
-		if err != nil {
-			log.Fatal("Error finding directory of process: ", err)
-		}
-		path = filepath.Dir(ex) + "\\login.json"
+		path = loginPath()
 	}
 
 	if path != "" {
@@ -116,159 +266,461 @@ func main() {
 		json.Unmarshal(byteValue, &login)
 	}
 
-	// Retrieves the files from the directory. Fatal error if something goes wrong.
-	files, err := telelib.GetFiles(".")
-	if err != nil {
-		log.Fatal("Error in retrieving files from directory | full error", err)
-	}
+	// Retrieves the files from the directories. Fatal error if something goes wrong.
+	files, baseDirs := source.files()
 
 	// Parse everything in the folder.
-	var rawFileInfo []telelib.RawFileInfo
-	if *series == "" {
-		rawFileInfo = telelib.ParseFiles(files)
-	} else {
-		rawFileInfo = telelib.ParseFilesWithSeries(files, *series)
+	rawFileInfo, skipped := telelib.ParseFilesWithOptions(files, telelib.ParseOptions{Series: *series, Filter: source.filter})
+
+	// Look everything up before touching any files.
+	plan := telelib.NewPlan(rawFileInfo, telelib.TVDBLookup(login), baseDirNamer(newNamer, baseDirs))
+	plan = plan.WithAction(action)
+	plan, collisionErr := plan.ResolveCollisionsWithOptions(collisionOptions)
+	// Companions and folders follow the final names of the episodes, once collisions have been resolved.
+	if !*noCompanions {
+		plan = plan.AddCompanionsWithOptions(source.filter.Companions(files), namingOptions)
+	}
+	if folderOptions.SeasonFormat != "" || folderOptions.SeriesFormat != "" {
+		plan = plan.RenameFolders(folderOptions)
+	}
+	if *verbose {
+		logSkipped(plan, skipped)
+	}
+
+	if *savePlan != "" {
+		if err := telelib.SavePlan(plan, *savePlan); err != nil {
+			log.Fatal(err)
+		}
+		log.Print(fmt.Sprintf("Saved plan to %v", *savePlan))
+	}
+
+	if *dryRun || *savePlan != "" {
+		if !printPlan(plan, *jsonOutput) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if collisionErr != nil {
+		printPlan(plan.Filter(func(entry telelib.PlanEntry) bool { return entry.Error != "" }), false)
+		log.Fatal(collisionErr, ", nothing has been renamed")
+	}
+
+	for _, v := range plan.Failed() {
+		log.Print(fmt.Sprintf("Error with file %v | full error: %v", v.OldFileName, v.Error))
 	}
+	logWarnings(plan)
 
 	if *confirm == false {
-		automatedRenames(rawFileInfo, login, *format)
+		automatedRenames(plan, applyOptions)
 	} else {
-		seqeuentialRenames(rawFileInfo, login, *format)
+		seqeuentialRenames(plan, applyOptions)
 	}
 }
 
-func writeRenames(renames []telelib.FileRename) {
-	renamesJSON, err := json.Marshal(renames)
+// currentDirectory is the directory operations are recorded against, along with the folders of the files they renamed.
+// Operations can be undone from any of them.
+func currentDirectory() string {
+	directory, err := filepath.Abs(".")
 	if err != nil {
 		log.Fatal(err)
 	}
+	return directory
+}
+
+// recoverOperation reconciles an operation's journal with the files on disk, in case it was interrupted.
+func recoverOperation(history telelib.History, op telelib.Operation) ([]telelib.JournalRecord, []telelib.FileRename) {
+	// The run may have been stopped before anything was journalled.
+	if _, err := os.Stat(history.JournalPath(op)); os.IsNotExist(err) {
+		return nil, nil
+	}
 
-	// As it is a relatively small file, we'll store it within the OS' temporary store.
-	// While good practice is to remove it, the purpose of this file is (temporary) persistence.
-	// Undos are likely to be performed somewhat immediately after the operation, so it doesn't matter if the OS removes it.
-	// telenamer isn't a background task that can clean this up.
-	ioutil.WriteFile(os.TempDir()+"\\telenamer_renames.json", renamesJSON, 0644)
+	completed, unresolved, err := telelib.RecoverJournal(history.JournalPath(op))
+	if err != nil {
+		log.Fatal("Could not load the rename journal: ", err)
+	}
+
+	for _, v := range unresolved {
+		log.Print(fmt.Sprintf("Unable to tell whether %q was renamed to %q, check it by hand", v.OldFileName, v.NewFileName))
+	}
+
+	return completed, unresolved
 }
 
-func undoRenames() {
-	// Opens up the temporary file stored. If it doesn't exist, we fatal error.
-	tempFile := os.TempDir() + "\\telenamer_renames.json"
-	renamesFile, err := os.Open(tempFile)
+// undoOperation reverses every rename an operation performed, newest first. Returns false if anything couldn't be.
+// Each rename is checked before it is reversed, and conflicts are reported rather than overwriting anything.
+func undoOperation(history telelib.History, op telelib.Operation) bool {
+	// Older operations journalled renames relative to the directory they were made in, so would reverse the wrong
+	// files from anywhere else.
+	if !op.PerformedIn(currentDirectory()) {
+		log.Print(fmt.Sprintf("Operation %v was performed in %v, and can only be undone from there", op.ID, strings.Join(append([]string{op.Directory}, op.Targets...), ", ")))
+		return false
+	}
+
+	completed, unresolved := recoverOperation(history, op)
+
+	var errs []error
+	if len(completed) > 0 {
+		// Reversed renames are journalled too, so that an undo that fails part way through can be picked up again.
+		journal, err := telelib.ResumeJournal(history.JournalPath(op), completed)
+		if err != nil {
+			log.Fatal(err)
+		}
+		errs = journal.Rollback()
+		journal.Close()
+	}
+
+	for _, err := range errs {
+		log.Print(err)
+	}
+	if len(errs) > 0 {
+		log.Print(fmt.Sprintf("Renamed %v of %v files back, run the undo again once the conflicts are fixed", len(completed)-len(errs), len(completed)))
+	} else {
+		for _, v := range completed {
+			if v.Action.Moves() {
+				log.Print(fmt.Sprintf("%v %v back to %v", actionVerb(v.Action), v.NewFileName, v.OldFileName))
+			} else {
+				log.Print(fmt.Sprintf("Removed %v", v.NewFileName))
+			}
+		}
+	}
+
+	// Once we've performed a undo, no need for the operation to exist anymore, unless something still needs looking at.
+	if len(errs) > 0 || len(unresolved) > 0 {
+		return false
+	}
+	if err := history.Remove(op); err != nil {
+		log.Print(err)
+	}
+	return true
+}
+
+// undoRenames undoes the given operation, or the last count operations performed in the current directory.
+func undoRenames(id string, count int) {
+	history := renameHistory()
+	directory := currentDirectory()
+
+	var ops []telelib.Operation
+	if id != "" {
+		op, err := history.Find(directory, id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ops = append(ops, op)
+	} else {
+		all, err := history.Operations(directory)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if count < len(all) {
+			all = all[:count]
+		}
+		ops = all
+	}
+
+	if len(ops) == 0 {
+		log.Fatal("Nothing to undo in ", directory)
+	}
+
+	// Operations are undone newest first, and stop at the first that can't be, as older operations may depend on it.
+	for _, v := range ops {
+		log.Print(fmt.Sprintf("Undoing operation %v, from %v", v.ID, v.Time.Format(time.RFC1123)))
+		if !undoOperation(history, v) {
+			log.Fatal("Unable to undo operation ", v.ID)
+		}
+	}
+}
+
+// journalled reports whether an operation's journal has any renames that can be undone, or need checking by hand.
+func journalled(history telelib.History, op telelib.Operation) bool {
+	records, err := telelib.ReadJournal(history.JournalPath(op))
 	if err != nil {
-		log.Fatal("Could not load telenamer_renames.json: ", err)
+		// Without a journal that can be read, the operation is kept, in case it can be recovered.
+		_, statErr := os.Stat(history.JournalPath(op))
+		return !os.IsNotExist(statErr)
 	}
 
-	var renames []telelib.FileRename
-	byteValue, err := ioutil.ReadAll(renamesFile)
+	completed, unresolved := telelib.ReconcileJournal(records)
+	return len(completed) > 0 || len(unresolved) > 0
+}
 
+// listHistory prints every operation that can be undone in the current directory, newest first.
+func listHistory() {
+	history := renameHistory()
+	ops, err := history.Operations(currentDirectory())
 	if err != nil {
-		log.Fatal("Unable to load telenamers_renames.json: ", err)
+		log.Fatal(err)
 	}
-	json.Unmarshal(byteValue, &renames)
 
-	for _, v := range renames {
-		// Flip it and run it through the same function again.
-		telelib.FileRename{OldFileName: v.NewFileName, NewFileName: v.OldFileName}.RenameFile()
-		log.Print(fmt.Sprintf("Renamed %v back to %v", v.NewFileName, v.OldFileName))
+	// The history is the output the user asked for, so it's printed even if silent.
+	for _, v := range ops {
+		// A journal that can't be read just has no renames to show.
+		records, _ := telelib.ReadJournal(history.JournalPath(v))
+		completed, _ := telelib.ReconcileJournal(records)
+		fmt.Printf("%v\t%v\t%v renames\n", v.ID, v.Time.Format(time.RFC1123), len(completed))
 	}
+}
 
-	renamesFile.Close()
-	// Once we've performed a undo, no need for the file to exist anymore.
-	os.Remove(tempFile)
+func automatedRenames(plan telelib.Plan, applyOptions telelib.ApplyOptions) {
+	// Renames are journalled with absolute paths, so that they can be undone from any folder they were made in.
+	plan, err := plan.Absolute()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	history := renameHistory()
+	op, err := history.Start(currentDirectory(), plan.Directories()...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	applyOptions.JournalPath = history.JournalPath(op)
+
+	renames, errs := plan.ApplyWithOptions(applyOptions)
+	// Operations that left nothing renamed have nothing to undo, so aren't worth keeping. The journal is checked
+	// rather than what was returned, as renames an atomic rollback failed to reverse still need undoing.
+	if !journalled(history, op) {
+		history.Remove(op)
+	}
+
+	for _, err := range errs {
+		log.Print("error in renaming file | full error: ", err)
+	}
+	if applyOptions.Atomic && len(errs) > 0 {
+		if len(renames) == 0 {
+			log.Fatal("Rolled back every rename, nothing has been renamed")
+		}
+		// Renames the rollback couldn't reverse are still in the history, to be undone once fixed.
+		for _, v := range renames {
+			log.Print(fmt.Sprintf("%q is still %v to %q", v.OldFileName, strings.ToLower(actionVerb(v.Action)), v.NewFileName))
+		}
+		log.Fatal(fmt.Sprintf("Rolled back all but %v renames, undo them with --undo once the errors are fixed", len(renames)))
+	}
+	for _, v := range renames {
+		log.Print(fmt.Sprintf("%v %q to %q", actionVerb(v.Action), v.OldFileName, v.NewFileName))
+	}
 }
 
-func automatedRenames(rawFileInfo []telelib.RawFileInfo, login telelib.TVDBLogin, format string) {
-	// Store file renames, so that we can offer an undo option.
-	renameChan := make(chan fileRenameErr, len(rawFileInfo))
+// applySavedPlan applies a plan from --save-plan, refusing to rename anything if the files have changed since.
+func applySavedPlan(path string, collisionOptions telelib.CollisionOptions, applyOptions telelib.ApplyOptions) {
+	plan, err := telelib.LoadPlan(path)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	for _, v := range rawFileInfo {
-		// Create a GoRoutine that retrieves the episode for each info, and performs a rename operation.
-		go func(v telelib.RawFileInfo, login telelib.TVDBLogin, format string, renameChan chan fileRenameErr) {
-			epInfo, err := v.RetrieveEpisodeInfo(login)
+	if errs := plan.Verify(); len(errs) > 0 {
+		for _, err := range errs {
+			log.Print(err)
+		}
+		log.Fatal("Plan no longer matches the files on disk, nothing has been renamed")
+	}
 
-			if err != nil {
-				log.Print("error in retrieving episode info | full error: ", err)
-				renameChan <- fileRenameErr{Error: err}
-			} else {
-				fileRename := epInfo.NewFileName(format)
-				err := fileRename.RenameFile()
-
-				if err != nil {
-					log.Print("error in renaming file | full error: ", err)
-					renameChan <- fileRenameErr{Error: err}
-				} else {
-					log.Print(fmt.Sprintf("Renamed %q to %q", fileRename.OldFileName, fileRename.NewFileName))
-					renameChan <- fileRenameErr{FileRename: fileRename}
-				}
-			}
-		}(v, login, format, renameChan)
+	// Names may have been edited by hand since the plan was saved, so they're checked again.
+	plan, err = plan.ResolveCollisionsWithOptions(collisionOptions)
+	if err != nil {
+		printPlan(plan.Filter(func(entry telelib.PlanEntry) bool { return entry.Error != "" }), false)
+		log.Fatal(err, ", nothing has been renamed")
 	}
+	logWarnings(plan)
 
-	// Ensure all the renames are performed, and add them to the renames list to write to disk.
-	var renames []telelib.FileRename
-	for range rawFileInfo {
-		result := <-renameChan
+	automatedRenames(plan, applyOptions)
+}
+
+// logWarnings logs every warning within a plan, such as files skipped due to collisions.
+func logWarnings(plan telelib.Plan) {
+	for _, v := range plan.Entries {
+		for _, warning := range v.Warnings {
+			log.Print(fmt.Sprintf("%v: %v", v.OldFileName, warning))
+		}
+	}
+}
 
-		// We log any errors, so there is no need to actually use the info here.
-		if result.Error == nil {
-			renames = append(renames, result.FileRename)
+// printPlan prints the renames that would happen, in order. Returns false if any file would fail.
+func printPlan(plan telelib.Plan, jsonOutput bool) bool {
+	// The plan is the output the user asked for, so it's printed even if silent.
+	if jsonOutput {
+		planJSON, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(planJSON))
+	} else {
+		for _, v := range plan.Entries {
+			if v.Error != "" {
+				fmt.Printf("%v -> error: %v\n", v.OldFileName, v.Error)
+			} else if v.Unchanged() {
+				fmt.Printf("%v -> unchanged\n", v.OldFileName)
+			} else if v.Skip {
+				fmt.Printf("%v -> skipped\n", v.OldFileName)
+			} else {
+				fmt.Printf("%v -> %v\n", v.OldFileName, v.NewFileName)
+			}
+			for _, warning := range v.Warnings {
+				fmt.Printf("    %v\n", warning)
+			}
 		}
 	}
 
-	writeRenames(renames)
+	return len(plan.Failed()) == 0
 }
 
-func seqeuentialRenames(rawFileInfo []telelib.RawFileInfo, login telelib.TVDBLogin, format string) {
+func seqeuentialRenames(plan telelib.Plan, applyOptions telelib.ApplyOptions) {
 	// Allowing the user to have control over the filename changes significantly slows down the operation,
 	// so we'll go for a UX-best approach rather than prioritising performance.
 	// The non-confirm section of the loop can deal with maximum performance.
+	for i, v := range plan.Entries {
+		if !v.Pending() {
+			continue
+		}
+		var input string
+
+		// Presents file rename for user to confirm.
+		// Both isn't a log, and has to be displayed even if silent.
+		fmt.Println("Old: " + v.OldFileName)
+		fmt.Println("New: " + v.NewFileName)
+		fmt.Print("Are you sure? y/n | ")
+		fmt.Scanln(&input)
+
+		// Anything other than a y leaves the file as it is.
+		plan.Entries[i].Skip = input != "y"
+		fmt.Println("------------")
+	}
+
+	automatedRenames(plan, applyOptions)
+}
+
+func previewFormat(newNamer func(string) telelib.Namer, samplePairs []string, files bool, source fileSource, series string) {
+	// Previews are the output the user asked for, so they're printed even if silent.
+	if !files {
+		sample, err := telelib.ParseSample(samplePairs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(newNamer("")(sample).NewFileName)
+		return
+	}
+
+	fileList, baseDirs := source.files()
+	namer := baseDirNamer(newNamer, baseDirs)
+
+	rawFileInfo, _ := telelib.ParseFilesWithOptions(fileList, telelib.ParseOptions{Series: series, Filter: source.filter})
 
-	// Store a list of channels.
-	var parsedChans []chan telelib.ParsedFileInfo
 	for _, v := range rawFileInfo {
-		parsedChan := make(chan telelib.ParsedFileInfo)
-		// Adds each individual channel to a list, so that we can retrieve the results in-order later.
-		parsedChans = append(parsedChans, parsedChan)
-		go func(v telelib.RawFileInfo, login telelib.TVDBLogin, parsedChan chan telelib.ParsedFileInfo) {
-			// Retireves the episode info.
-			result, err := v.RetrieveEpisodeInfo(login)
-
-			if err != nil {
-				log.Print(fmt.Sprintf("Error retrieving episode info for file %v, inferred info series %v, season %v, episode %v", v.FileName, v.Series, v.Season, v.Episode))
-			}
+		// Nothing is looked up, so there is no episode name to use.
+		fileRename := namer(telelib.ParsedFileInfo{
+			FileName:    v.FileName,
+			Container:   v.Container,
+			Season:      v.Season,
+			Episode:     v.Episode,
+			LastEpisode: v.LastEpisode,
+			EpisodeName: fmt.Sprintf("Episode %v", v.Episode),
+			Series:      v.Series,
+			Language:    v.Language,
+			SubFlags:    v.SubFlags,
+		})
+		fmt.Printf("%v -> %v\n", fileRename.OldFileName, fileRename.NewFileName)
+	}
+}
 
-			parsedChan <- result
-		}(v, login, parsedChan)
-	}
-
-	var renames []telelib.FileRename
-
-	for _, v := range parsedChans {
-		result := <-v
-		// A blank struct is returned if there is an error, so we can just discard anything with a blank struct.
-		if (result != telelib.ParsedFileInfo{}) {
-			fileRename := result.NewFileName(format)
-			var input string
-
-			// Presents file rename for user to confirm.
-			// Both isn't a log, and has to be displayed even if silent.
-			fmt.Println("Old: " + fileRename.OldFileName)
-			fmt.Println("New: " + fileRename.NewFileName)
-			fmt.Print("Are you sure? y/n | ")
-			fmt.Scanln(&input)
-
-			// If they input a y, we'll rename the file and add it to the list of performed renames.
-			if input == "y" {
-				err := fileRename.RenameFile()
-				if err != nil {
-					log.Print("error renaming file | full error: ", err)
-				} else {
-					renames = append(renames, fileRename)
-				}
-			}
-			fmt.Println("------------")
+// fileSource is where the files to rename are found.
+type fileSource struct {
+	paths     []string
+	recursive bool
+	walk      telelib.WalkOptions
+	filter    telelib.FileFilter
+}
+
+// files retrieves every file to rename from the folders and files given, or the current directory if none are.
+// Also returns the folder each file was found within, to create the folders of formats in.
+func (source fileSource) files() ([]string, map[string]string) {
+	paths := source.paths
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	var files []string
+	baseDirs := make(map[string]string)
+	for _, v := range paths {
+		// New names are joined onto the folder, which cleans them, so old names have to be clean to match.
+		v = filepath.Clean(v)
+		info, err := os.Stat(v)
+		if err != nil {
+			log.Fatal("Error in retrieving files | full error ", err)
 		}
+
+		if !info.IsDir() {
+			files = append(files, v)
+			continue
+		}
+
+		var dirFiles []string
+		if source.recursive {
+			dirFiles, err = telelib.WalkFiles(v, source.walk)
+		} else {
+			dirFiles, err = telelib.GetFiles(v)
+		}
+		if err != nil {
+			log.Fatal("Error in retrieving files from directory | full error", err)
+		}
+
+		for _, file := range dirFiles {
+			baseDirs[file] = v
+		}
+		files = append(files, dirFiles...)
 	}
 
-	writeRenames(renames)
+	return files, baseDirs
+}
+
+// baseDirNamer names each file with a namer for the folder it was found within.
+func baseDirNamer(newNamer func(string) telelib.Namer, baseDirs map[string]string) telelib.Namer {
+	return func(p telelib.ParsedFileInfo) telelib.FileRename {
+		return newNamer(baseDirs[p.FileName])(p)
+	}
+}
+
+// actionVerb describes an action that has been performed, for logging.
+func actionVerb(action telelib.Action) string {
+	switch action {
+	case telelib.ActionMove:
+		return "Moved"
+	case telelib.ActionCopy:
+		return "Copied"
+	case telelib.ActionHardlink:
+		return "Hardlinked"
+	case telelib.ActionSymlink:
+		return "Symlinked"
+	case telelib.ActionReflink:
+		return "Reflinked"
+	}
+	return "Renamed"
+}
+
+// progressLogger logs how far through copying each file is, every 10%.
+func progressLogger() func(telelib.FileRename, int64, int64) {
+	logged := make(map[telelib.FileRename]int64)
+	return func(file telelib.FileRename, copied int64, total int64) {
+		if total == 0 {
+			return
+		}
+
+		percent := copied * 100 / total
+		if percent/10 > logged[file]/10 {
+			logged[file] = percent
+			log.Print(fmt.Sprintf("Copying %q: %v%%", file.OldFileName, percent))
+		}
+	}
+}
+
+// logSkipped logs every file that won't be renamed, and why, except for those renamed along with a video.
+func logSkipped(plan telelib.Plan, skipped []telelib.SkippedFile) {
+	planned := make(map[string]bool)
+	for _, v := range plan.Entries {
+		planned[v.OldFileName] = true
+	}
+
+	for _, v := range skipped {
+		if !planned[v.FileName] {
+			log.Print(fmt.Sprintf("Skipped %q: %v", v.FileName, v.Reason))
+		}
+	}
 }
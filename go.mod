@@ -8,4 +8,6 @@ require (
 	github.com/middelink/go-parse-torrent-name v0.0.0-20190301154245-3ff4efacd4c4
 	github.com/pioz/tvdb v0.0.0-20190503215423-f45c687faba9
 	github.com/spf13/afero v1.3.1
+	golang.org/x/text v0.3.0
+	sigs.k8s.io/yaml v1.3.0
 )
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/arrivance/telenamer/telelib"
+)
+
+// configDir is where telenamer's configuration, such as login.json, lives: $XDG_CONFIG_HOME/telenamer (usually
+// ~/.config/telenamer) on Linux, %AppData%\telenamer on Windows and ~/Library/Application Support/telenamer on macOS.
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding configuration folder %v", err)
+	}
+	return filepath.Join(dir, "telenamer"), nil
+}
+
+// stateDir is where telenamer keeps state between runs, such as the undo history: $XDG_STATE_HOME/telenamer (usually
+// ~/.local/state/telenamer) on Linux, %LocalAppData%\telenamer on Windows and ~/Library/Application Support/telenamer
+// on macOS.
+func stateDir() (string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		if dir := os.Getenv("LocalAppData"); dir != "" {
+			return filepath.Join(dir, "telenamer"), nil
+		}
+		return configDir()
+	case "darwin", "ios", "plan9":
+		return configDir()
+	}
+
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "telenamer"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding state folder %v", err)
+	}
+	return filepath.Join(home, ".local", "state", "telenamer"), nil
+}
+
+// loginPath is where login.json is read from, when no other login details are given. Login files from older
+// versions, which lived next to the executable, are copied there. The original is left where it is, as other users
+// of a shared executable may still need it.
+func loginPath() string {
+	dir, err := configDir()
+	if err != nil {
+		log.Fatal(err)
+	}
+	path := filepath.Join(dir, "login.json")
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+
+	ex, err := os.Executable()
+	if err != nil {
+		log.Fatal("Error finding directory of process: ", err)
+	}
+	// Older versions always joined paths with \, which on anything but Windows is part of the file name.
+	for _, legacy := range []string{filepath.Join(filepath.Dir(ex), "login.json"), filepath.Dir(ex) + "\\login.json"} {
+		if _, err := os.Stat(legacy); err != nil {
+			continue
+		}
+
+		if err := copyLegacyFile(legacy, path, 0600); err != nil {
+			log.Print(fmt.Sprintf("Unable to copy %v to %v, using it where it is: %v", legacy, path, err))
+			return legacy
+		}
+		log.Print(fmt.Sprintf("Copied %v to %v", legacy, path))
+		return path
+	}
+
+	return path
+}
+
+// copyLegacyFile copies a file from an old location to its new one.
+func copyLegacyFile(from string, to string, perm os.FileMode) error {
+	contents, err := ioutil.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(to, contents, perm)
+}
+
+// renameHistory is where every operation is journalled, so that we can offer an undo option. Undo information from
+// older versions, which lived in the OS' temporary store, is moved there.
+func renameHistory() telelib.History {
+	dir, err := stateDir()
+	if err != nil {
+		log.Fatal(err)
+	}
+	history := telelib.History{Dir: filepath.Join(dir, "history")}
+
+	migrateHistory(history)
+	return history
+}
+
+// migrateHistory moves undo information left in the OS' temporary store by older versions into the history.
+func migrateHistory(history telelib.History) {
+	// Older versions only kept the last operation, with no record of the directory it was performed in, and always
+	// joined paths with \, which on anything but Windows is part of the file name.
+	for _, legacy := range []string{filepath.Join(os.TempDir(), "telenamer_renames.json"), os.TempDir() + "\\telenamer_renames.json"} {
+		renamesJSON, err := ioutil.ReadFile(legacy)
+		if err != nil {
+			continue
+		}
+		// The file was last written by the operation it records.
+		stat, err := os.Stat(legacy)
+		if err != nil {
+			continue
+		}
+
+		var renames []telelib.FileRename
+		if err := json.Unmarshal(renamesJSON, &renames); err != nil {
+			log.Print(fmt.Sprintf("Unable to read the undo information in %v: %v", legacy, err))
+			continue
+		}
+		if _, err := history.Import("", renames, stat.ModTime()); err != nil {
+			log.Print(fmt.Sprintf("Unable to move the undo information in %v: %v", legacy, err))
+			continue
+		}
+		os.Remove(legacy)
+	}
+}
@@ -0,0 +1,206 @@
+package telelib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/afero"
+)
+
+// Action is how a file ends up at its new name.
+type Action string
+
+const (
+	// ActionRename renames the file. The default.
+	ActionRename Action = "rename"
+	// ActionMove moves the file, usually to another folder, such as a library. Unlike ActionRename, files can be
+	// moved to another filesystem, by copying and then removing them.
+	ActionMove Action = "move"
+	// ActionCopy copies the file, leaving the original untouched.
+	ActionCopy Action = "copy"
+	// ActionHardlink hardlinks the file, leaving the original untouched without taking up any more space.
+	// Both names have to be on the same filesystem.
+	ActionHardlink Action = "hardlink"
+	// ActionSymlink creates a symbolic link to the original file.
+	ActionSymlink Action = "symlink"
+	// ActionReflink makes a copy-on-write copy of the file, on filesystems that support them (e.g. Btrfs or XFS).
+	ActionReflink Action = "reflink"
+)
+
+// Actions lists the names accepted by ParseAction.
+var Actions = []string{string(ActionRename), string(ActionMove), string(ActionCopy), string(ActionHardlink), string(ActionSymlink), string(ActionReflink)}
+
+// ParseAction retrieves an action from its name.
+func ParseAction(name string) (Action, error) {
+	for _, v := range Actions {
+		if strings.ToLower(name) == v {
+			return Action(v), nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown action %q, expected one of %v", name, Actions)
+}
+
+// Moves reports whether the action takes the file away from its old name, rather than leaving the original in place.
+func (action Action) Moves() bool {
+	return action == "" || action == ActionRename || action == ActionMove
+}
+
+// Revert undoes the rename: files that were renamed or moved are put back, and copies and links are removed.
+func (file FileRename) Revert() error {
+	if file.Action.Moves() {
+		// Flip it and run it through the same function again.
+		return FileRename{OldFileName: file.NewFileName, NewFileName: file.OldFileName, Action: file.Action}.RenameFile()
+	}
+
+	if err := fs.Remove(file.NewFileName); err != nil {
+		return fmt.Errorf("error removing %v", err)
+	}
+	return nil
+}
+
+// Progress is called as a file is copied, with how many bytes have been copied so far, out of the total.
+type Progress func(copied int64, total int64)
+
+// progressWriter reports how much has been written through it.
+type progressWriter struct {
+	copied   int64
+	total    int64
+	progress Progress
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.copied += int64(len(p))
+	if w.progress != nil {
+		w.progress(w.copied, w.total)
+	}
+	return len(p), nil
+}
+
+// copyFile copies a file's contents, permissions and modification time. The copy is written under a temporary name,
+// and checked against the original before it is given its new name, so a copy that fails part way through never
+// appears to be complete, and is cleaned up.
+func copyFile(oldFileName string, newFileName string, progress Progress) error {
+	if exists, _ := fsutil.Exists(newFileName); exists {
+		return fmt.Errorf("error copying %v: %v already exists", oldFileName, newFileName)
+	}
+
+	info, err := fs.Stat(oldFileName)
+	if err != nil {
+		return fmt.Errorf("error copying %v", err)
+	}
+
+	partial := newFileName + ".partial"
+	if err := copyContents(oldFileName, partial, info, progress); err != nil {
+		fs.Remove(partial)
+		return err
+	}
+
+	if err := fs.Rename(partial, newFileName); err != nil {
+		fs.Remove(partial)
+		return fmt.Errorf("error copying %v", err)
+	}
+	return nil
+}
+
+// copyContents copies a file to a new file, and checks the copy matches the original.
+func copyContents(oldFileName string, newFileName string, info os.FileInfo, progress Progress) error {
+	src, err := fs.Open(oldFileName)
+	if err != nil {
+		return fmt.Errorf("error copying %v", err)
+	}
+	defer src.Close()
+
+	// O_EXCL, as a copy should never replace anything.
+	dst, err := fs.OpenFile(newFileName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("error copying %v", err)
+	}
+
+	// The original is hashed as it is copied, so it only has to be read once.
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(dst, hash, &progressWriter{total: info.Size(), progress: progress}), src)
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error copying %v", err)
+	}
+
+	copied, err := hashFile(newFileName)
+	if err != nil {
+		return fmt.Errorf("error verifying copy %v", err)
+	}
+	if copied != hex.EncodeToString(hash.Sum(nil)) {
+		return fmt.Errorf("error copying %v: the copy doesn't match the original", oldFileName)
+	}
+
+	// Permissions given to OpenFile are reduced by the umask, so they're set again.
+	if err := fs.Chmod(newFileName, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("error copying permissions %v", err)
+	}
+	if err := fs.Chtimes(newFileName, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("error copying modification time %v", err)
+	}
+	return nil
+}
+
+// moveFile moves a file. Renaming doesn't work between filesystems, so the file is copied, checked, and the
+// original removed instead.
+func moveFile(oldFileName string, newFileName string, progress Progress) error {
+	err := fs.Rename(oldFileName, newFileName)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return fmt.Errorf("error renaming %v", err)
+	}
+
+	if err := copyFile(oldFileName, newFileName, progress); err != nil {
+		return err
+	}
+	if err := fs.Remove(oldFileName); err != nil {
+		return fmt.Errorf("error removing %v after copying it to %v: %v", oldFileName, newFileName, err)
+	}
+	return nil
+}
+
+// hardlinkFile hardlinks a file. Only possible on the OS filesystem, as afero has no hardlinks.
+func hardlinkFile(oldFileName string, newFileName string) error {
+	if _, ok := fs.(*afero.OsFs); !ok {
+		return fmt.Errorf("error hardlinking %v: hardlinks are not supported by %v", oldFileName, fs.Name())
+	}
+
+	if err := os.Link(oldFileName, newFileName); err != nil {
+		return fmt.Errorf("error hardlinking %v", err)
+	}
+	return nil
+}
+
+// symlinkFile creates a symbolic link to a file. Links point to the absolute path of the file, so that they don't
+// break when the link is in another folder.
+func symlinkFile(oldFileName string, newFileName string) error {
+	linker, ok := fs.(afero.Linker)
+	if !ok {
+		return fmt.Errorf("error symlinking %v: symlinks are not supported by %v", oldFileName, fs.Name())
+	}
+
+	target, err := filepath.Abs(oldFileName)
+	if err != nil {
+		return fmt.Errorf("error symlinking %v", err)
+	}
+	if err := linker.SymlinkIfPossible(target, newFileName); err != nil {
+		return fmt.Errorf("error symlinking %v", err)
+	}
+	return nil
+}
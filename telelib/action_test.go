@@ -0,0 +1,116 @@
+package telelib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestParseAction(t *testing.T) {
+	if action, err := ParseAction("Hardlink"); err != nil || action != ActionHardlink {
+		t.Errorf("ParseAction(%q) = %q, %v, expected %q", "Hardlink", action, err, ActionHardlink)
+	}
+	if _, err := ParseAction("teleport"); err == nil {
+		t.Errorf("ParseAction(%q) returned no error", "teleport")
+	}
+}
+
+func TestRenameFileCopy(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	afero.WriteFile(fs, "a.mkv", []byte("random contents"), 0640)
+	fs.Chtimes("a.mkv", modTime, modTime)
+
+	file := FileRename{OldFileName: "a.mkv", NewFileName: "library/A.mkv", Action: ActionCopy}
+	if err := file.RenameFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, _ := afero.Exists(fs, "a.mkv"); !exists {
+		t.Errorf("RenameFile() with %q removed the original", ActionCopy)
+	}
+	if contents, _ := afero.ReadFile(fs, "library/A.mkv"); string(contents) != "random contents" {
+		t.Errorf("RenameFile() with %q copied %q", ActionCopy, contents)
+	}
+	if info, err := fs.Stat("library/A.mkv"); err != nil || !info.ModTime().Equal(modTime) || info.Mode().Perm() != 0640 {
+		t.Errorf("RenameFile() with %q didn't keep the modification time and permissions: %v", ActionCopy, info)
+	}
+
+	// Copies never replace anything.
+	if err := file.RenameFile(); err == nil {
+		t.Errorf("RenameFile() with %q replaced an existing file", ActionCopy)
+	}
+
+	if err := file.Revert(); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := afero.Exists(fs, "library/A.mkv"); exists {
+		t.Errorf("Revert() with %q didn't remove the copy", ActionCopy)
+	}
+	if exists, _ := afero.Exists(fs, "a.mkv"); !exists {
+		t.Errorf("Revert() with %q removed the original", ActionCopy)
+	}
+}
+
+func TestRenameFileLinksUnsupported(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	afero.WriteFile(fs, "a.mkv", []byte("random contents"), 0644)
+
+	for _, v := range []Action{ActionHardlink, ActionSymlink, ActionReflink} {
+		if err := (FileRename{OldFileName: "a.mkv", NewFileName: "A.mkv", Action: v}).RenameFile(); err == nil {
+			t.Errorf("RenameFile() with %q succeeded on a filesystem without links", v)
+		}
+	}
+}
+
+func TestRollbackCopyWithoutOriginal(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	afero.WriteFile(fs, "a.mkv", []byte("random contents"), 0644)
+
+	var journal Journal
+	file := FileRename{OldFileName: "a.mkv", NewFileName: "A.mkv", Action: ActionCopy}
+	if err := file.RenameFile(); err != nil {
+		t.Fatal(err)
+	}
+	journal.Record(file)
+	fs.Remove("a.mkv")
+
+	if errs := journal.Rollback(); len(errs) != 1 {
+		t.Errorf("Journal.Rollback() returned errors %v, expected one as the original is gone", errs)
+	}
+	if exists, _ := afero.Exists(fs, "A.mkv"); !exists {
+		t.Errorf("Journal.Rollback() removed the only copy of the file")
+	}
+}
+
+func TestResolveCollisionsCopy(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	afero.WriteFile(fs, "a.mkv", []byte("random contents"), 0644)
+	afero.WriteFile(fs, "b.mkv", []byte("random contents"), 0644)
+
+	// a.mkv is copied rather than moved, so b.mkv can't take its name.
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: "a.mkv", NewFileName: "A.mkv"}},
+		{FileRename: FileRename{OldFileName: "b.mkv", NewFileName: "a.mkv"}},
+	}}.WithAction(ActionCopy)
+
+	resolved, err := plan.ResolveCollisions(CollisionSkip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resolved.Entries[1].Skip {
+		t.Errorf("ResolveCollisions() didn't skip a copy over a file that is only copied away")
+	}
+	if resolved.Entries[0].Action != ActionCopy {
+		t.Errorf("WithAction() = %q, expected %q", resolved.Entries[0].Action, ActionCopy)
+	}
+}
@@ -0,0 +1,69 @@
+package telelib
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// caseOnly reports whether a rename only changes the capitalisation of a name, e.g. "the good place.mkv" to
+// "The Good Place.mkv". Case-insensitive filesystems, the default on Windows and macOS, treat both names as the same
+// file, so renaming can do nothing, or fail as the new name is taken.
+func (file FileRename) caseOnly() bool {
+	return file.OldFileName != file.NewFileName && strings.EqualFold(file.OldFileName, file.NewFileName)
+}
+
+// exists reports whether a file involved in the rename exists. For case-only renames that move the file, the name
+// has to match exactly, as case-insensitive filesystems find the file under both names.
+func (file FileRename) exists(fileName string) bool {
+	if file.caseOnly() && file.Action.Moves() {
+		return existsExactly(fileName)
+	}
+
+	exists, _ := fsutil.Exists(fileName)
+	return exists
+}
+
+// existsExactly reports whether a file exists with exactly the given name, not just one that differs in case.
+func existsExactly(fileName string) bool {
+	files, err := fsutil.ReadDir(filepath.Dir(fileName))
+	if err != nil {
+		return false
+	}
+
+	for _, v := range files {
+		if v.Name() == filepath.Base(fileName) {
+			return true
+		}
+	}
+	return false
+}
+
+// foldName is the name collisions are checked with, so that names differing only in case collide, as they do on
+// case-insensitive filesystems.
+func foldName(fileName string) string {
+	return strings.ToLower(fileName)
+}
+
+// renameCase performs a case-only rename through a temporary name, which works whether or not the filesystem is
+// case-insensitive.
+func renameCase(oldFileName string, newFileName string) error {
+	temp := ""
+	for i := 1; temp == ""; i++ {
+		candidate := fmt.Sprintf("%v.%v.tmp", oldFileName, i)
+		if exists, _ := fsutil.Exists(candidate); !exists {
+			temp = candidate
+		}
+	}
+
+	if err := fs.Rename(oldFileName, temp); err != nil {
+		return fmt.Errorf("error renaming %v", err)
+	}
+	if err := fs.Rename(temp, newFileName); err != nil {
+		// The file shouldn't be left under the temporary name.
+		fs.Rename(temp, oldFileName)
+		return fmt.Errorf("error renaming %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package telelib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+)
+
+// caseInsensitiveFs finds files whatever the case of their name, as Windows and macOS do, and does nothing when a file
+// is renamed to a name differing only in case.
+type caseInsensitiveFs struct {
+	afero.Fs
+}
+
+// resolve finds the name a file actually has.
+func (c caseInsensitiveFs) resolve(name string) string {
+	if _, err := c.Fs.Stat(name); err == nil {
+		return name
+	}
+
+	files, _ := afero.ReadDir(c.Fs, filepath.Dir(name))
+	for _, v := range files {
+		if strings.EqualFold(v.Name(), filepath.Base(name)) {
+			return filepath.Join(filepath.Dir(name), v.Name())
+		}
+	}
+	return name
+}
+
+func (c caseInsensitiveFs) Stat(name string) (os.FileInfo, error) {
+	return c.Fs.Stat(c.resolve(name))
+}
+
+func (c caseInsensitiveFs) Open(name string) (afero.File, error) {
+	return c.Fs.Open(c.resolve(name))
+}
+
+func (c caseInsensitiveFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	return c.Fs.OpenFile(c.resolve(name), flag, perm)
+}
+
+func (c caseInsensitiveFs) Remove(name string) error {
+	return c.Fs.Remove(c.resolve(name))
+}
+
+func (c caseInsensitiveFs) Rename(oldname string, newname string) error {
+	if c.resolve(oldname) == c.resolve(newname) {
+		return nil
+	}
+	return c.Fs.Rename(c.resolve(oldname), newname)
+}
+
+// names lists every file in the current directory of the memory filesystem, as they are actually named.
+func names(t *testing.T) []string {
+	files, err := afero.ReadDir(fs, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, v := range files {
+		names = append(names, v.Name())
+	}
+	return names
+}
+
+func TestCaseOnlyRename(t *testing.T) {
+	fs = caseInsensitiveFs{afero.NewMemMapFs()}
+	fsutil = &afero.Afero{Fs: fs}
+
+	afero.WriteFile(fs, "the good place.mkv", []byte("random contents"), 0644)
+	file := FileRename{OldFileName: "the good place.mkv", NewFileName: "The Good Place.mkv"}
+
+	// The file already being there under its new name isn't a collision.
+	plan, err := Plan{Entries: []PlanEntry{{FileRename: file}}}.ResolveCollisions(CollisionFail)
+	if err != nil || !plan.Entries[0].Pending() {
+		t.Fatalf("ResolveCollisions() == %+v, %v, expected the case-only rename to be pending", plan.Entries[0], err)
+	}
+
+	journal := &Journal{}
+	if err := file.RenameFile(); err != nil {
+		t.Fatal(err)
+	}
+	journal.Record(file)
+	if result, want := names(t), []string{"The Good Place.mkv"}; !cmp.Equal(result, want) {
+		t.Errorf("RenameFile() left %q, expected %q", result, want)
+	}
+
+	if errs := journal.Rollback(); len(errs) > 0 {
+		t.Fatalf("Rollback() == %v", errs)
+	}
+	if result, want := names(t), []string{"the good place.mkv"}; !cmp.Equal(result, want) {
+		t.Errorf("Rollback() left %q, expected %q", result, want)
+	}
+}
+
+func TestCaseCollisions(t *testing.T) {
+	fs = caseInsensitiveFs{afero.NewMemMapFs()}
+	fsutil = &afero.Afero{Fs: fs}
+
+	afero.WriteFile(fs, "a.mkv", []byte("random contents"), 0644)
+	afero.WriteFile(fs, "b.mkv", []byte("random contents"), 0644)
+	afero.WriteFile(fs, "c.mkv", []byte("random contents"), 0644)
+	afero.WriteFile(fs, "The Good Place.mkv", []byte("random contents"), 0644)
+
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: "a.mkv", NewFileName: "Brooklyn Nine-Nine.mkv"}},
+		{FileRename: FileRename{OldFileName: "b.mkv", NewFileName: "Brooklyn Nine-nine.mkv"}},
+		{FileRename: FileRename{OldFileName: "c.mkv", NewFileName: "the good place.mkv"}},
+	}}
+
+	resolved, err := plan.ResolveCollisions(CollisionSkip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pending []bool
+	for _, v := range resolved.Entries {
+		pending = append(pending, v.Pending())
+	}
+	if want := []bool{true, false, false}; !cmp.Equal(pending, want) {
+		t.Errorf("ResolveCollisions() pending == %v, expected %v", pending, want)
+	}
+}
@@ -0,0 +1,338 @@
+package telelib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	parsetorrentname "github.com/middelink/go-parse-torrent-name"
+)
+
+// CollisionPolicy decides what happens when a rename would overwrite another file.
+type CollisionPolicy string
+
+const (
+	// CollisionFail refuses to apply the plan at all.
+	CollisionFail CollisionPolicy = "fail"
+	// CollisionSkip leaves the colliding file as it is. When two files in a plan collide, the first keeps the name.
+	CollisionSkip CollisionPolicy = "skip"
+	// CollisionSuffix keeps both files, adding " (2)", " (3)", etc. to the later file's name.
+	CollisionSuffix CollisionPolicy = "suffix"
+	// CollisionKeepBest keeps the file with the higher resolution, or the larger file if they're the same,
+	// and leaves the other as it is. Existing files are renamed out of the way, adding " (2)", if the renamed file
+	// is better, rather than being replaced.
+	CollisionKeepBest CollisionPolicy = "best"
+	// CollisionQuarantine keeps the better file, as with CollisionKeepBest, but moves the other into a quarantine
+	// folder rather than leaving it where it is or replacing it.
+	// Both leave existing files as they are, and skip the colliding file, for actions that copy or link files.
+	CollisionQuarantine CollisionPolicy = "quarantine"
+)
+
+// CollisionPolicies lists the names accepted by ParseCollisionPolicy.
+var CollisionPolicies = []string{string(CollisionFail), string(CollisionSkip), string(CollisionSuffix), string(CollisionKeepBest), string(CollisionQuarantine)}
+
+// CollisionOptions changes how ResolveCollisionsWithOptions deals with collisions.
+type CollisionOptions struct {
+	Policy CollisionPolicy
+	// QuarantineDir is where CollisionQuarantine moves the worse copy of a file. Relative folders are relative
+	// to the file being moved. Defaults to DefaultQuarantineDir.
+	QuarantineDir string
+	// CompareHash compares the contents of colliding files, so identical copies are recognised as such no matter
+	// their names. The file already there is always kept over an identical copy. Slow for large files.
+	CompareHash bool
+}
+
+// DefaultQuarantineDir is where CollisionQuarantine moves files, unless CollisionOptions says otherwise.
+const DefaultQuarantineDir = "quarantine"
+
+// ParseCollisionPolicy retrieves a policy from its name.
+func ParseCollisionPolicy(name string) (CollisionPolicy, error) {
+	for _, v := range CollisionPolicies {
+		if strings.ToLower(name) == v {
+			return CollisionPolicy(v), nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown collision policy %q, expected one of %v", name, CollisionPolicies)
+}
+
+// ResolveCollisions finds pending renames that would end up with the same name as each other, or as a file that
+// already exists, and resolves them with the policy. fs.Rename happily overwrites files, so without this two copies
+// of an episode would silently replace one another.
+// With CollisionFail, the colliding entries are marked with errors, and an error is returned.
+func (plan Plan) ResolveCollisions(policy CollisionPolicy) (Plan, error) {
+	return plan.ResolveCollisionsWithOptions(CollisionOptions{Policy: policy})
+}
+
+// ResolveCollisionsWithOptions resolves collisions as ResolveCollisions does, as described by the options.
+// CollisionQuarantine may add entries to the plan, moving existing files out of the way.
+func (plan Plan) ResolveCollisionsWithOptions(opts CollisionOptions) (Plan, error) {
+	var resolved Plan
+
+	// Files that are renamed away make room for later renames, so aren't collisions. Names are folded, so that names
+	// differing only in case collide.
+	movedAway := make(map[string]bool)
+	// Names that are taken by an earlier entry in the plan.
+	claimed := make(map[string]int)
+	collisions := 0
+
+	for _, entry := range plan.Entries {
+		// Warnings are added to, and shouldn't end up in the original plan.
+		entry.Warnings = append([]string(nil), entry.Warnings...)
+
+		if !entry.Pending() || entry.Unchanged() {
+			resolved.Entries = append(resolved.Entries, entry)
+			continue
+		}
+
+		other, inPlan := claimed[foldName(entry.NewFileName)]
+		onDisk := false
+		if !inPlan && !movedAway[foldName(entry.NewFileName)] {
+			onDisk = entry.exists(entry.NewFileName)
+		}
+
+		// Folders can't be replaced by, or kept alongside, another folder, so are always left as they are.
+		if entry.Folder && (inPlan || onDisk) {
+			entry.Skip = true
+			entry.Warnings = append(entry.Warnings, fmt.Sprintf("skipped, as %v already exists", entry.NewFileName))
+		} else if inPlan || onDisk {
+			collisions++
+
+			existing := entry.NewFileName
+			if inPlan {
+				existing = resolved.Entries[other].OldFileName
+			}
+
+			switch opts.Policy {
+			case CollisionFail:
+				entry.Error = fmt.Sprintf("%v already exists", entry.NewFileName)
+			case CollisionSkip:
+				entry.Skip = true
+				entry.Warnings = append(entry.Warnings, fmt.Sprintf("skipped, as %v already exists", entry.NewFileName))
+			case CollisionSuffix:
+				newFileName := uniqueFileName(entry.NewFileName, claimed)
+				entry.Warnings = append(entry.Warnings, fmt.Sprintf("renamed to %v, as %v already exists", newFileName, entry.NewFileName))
+				entry.NewFileName = newFileName
+			case CollisionKeepBest, CollisionQuarantine:
+				// Copies and links leave the original where it is, so have nothing to quarantine, and can't take the
+				// name of an existing file, so leave it where it is.
+				keepBest := opts.Policy == CollisionKeepBest || !entry.Action.Moves()
+				better, identical := opts.compare(entry.OldFileName, existing)
+				if identical {
+					entry.Warnings = append(entry.Warnings, fmt.Sprintf("identical to %v", existing))
+				}
+
+				switch {
+				case !better && keepBest:
+					entry.Skip = true
+					entry.Warnings = append(entry.Warnings, fmt.Sprintf("skipped, as %v is the same or better", existing))
+				case !better:
+					entry.NewFileName = opts.quarantineName(entry.OldFileName, claimed)
+					entry.Warnings = append(entry.Warnings, fmt.Sprintf("moved to quarantine, as %v is the same or better", existing))
+				case inPlan && keepBest:
+					loser := &resolved.Entries[other]
+					if _, reused := claimed[foldName(existing)]; reused {
+						// A later entry takes the loser's old name, so the loser still has to move out of the way.
+						loser.NewFileName = uniqueFileName(loser.NewFileName, claimed)
+						loser.Warnings = append(loser.Warnings, fmt.Sprintf("renamed to %v, as %v is better", loser.NewFileName, entry.OldFileName))
+						claimed[foldName(loser.NewFileName)] = other
+					} else {
+						movedAway[foldName(existing)] = false
+						loser.Skip = true
+						loser.Warnings = append(loser.Warnings, fmt.Sprintf("skipped, as %v is better", entry.OldFileName))
+					}
+				case inPlan:
+					loser := &resolved.Entries[other]
+					loser.NewFileName = opts.quarantineName(loser.OldFileName, claimed)
+					loser.Warnings = append(loser.Warnings, fmt.Sprintf("moved to quarantine, as %v is better", entry.OldFileName))
+					claimed[foldName(loser.NewFileName)] = other
+				case !entry.Action.Moves():
+					entry.Skip = true
+					entry.Warnings = append(entry.Warnings, fmt.Sprintf("skipped, as %v already exists, and is only moved out of the way when renaming", existing))
+				default:
+					// The existing file has to be moved out of the way before this one can take its name. It is never
+					// overwritten, as a rename that replaces a file can't be undone.
+					aside := PlanEntry{
+						FileRename: FileRename{OldFileName: existing, NewFileName: opts.quarantineName(existing, claimed)},
+						Warnings:   []string{fmt.Sprintf("moved to quarantine, as %v is better", entry.OldFileName)},
+					}
+					if opts.Policy == CollisionKeepBest {
+						aside.NewFileName = uniqueFileName(existing, claimed)
+						aside.Warnings = []string{fmt.Sprintf("renamed to %v, as %v is better", aside.NewFileName, entry.OldFileName)}
+					}
+					claimed[foldName(aside.NewFileName)] = len(resolved.Entries)
+					movedAway[foldName(existing)] = true
+					resolved.Entries = append(resolved.Entries, aside)
+				}
+			}
+		}
+
+		if entry.Pending() {
+			claimed[foldName(entry.NewFileName)] = len(resolved.Entries)
+			if entry.Action.Moves() {
+				movedAway[foldName(entry.OldFileName)] = true
+			}
+		}
+		resolved.Entries = append(resolved.Entries, entry)
+	}
+
+	if opts.Policy == CollisionFail && collisions > 0 {
+		return resolved, fmt.Errorf("%v renames would overwrite another file", collisions)
+	}
+
+	return resolved, nil
+}
+
+// compare reports whether file a is a better copy of an episode than file b, and whether they are identical, if
+// comparing hashes. Ties go to b, which is already in place.
+func (opts CollisionOptions) compare(a string, b string) (better bool, identical bool) {
+	if opts.CompareHash {
+		hashA, errA := hashFile(a)
+		hashB, errB := hashFile(b)
+		if errA == nil && errB == nil && hashA == hashB {
+			return false, true
+		}
+	}
+
+	return compareQuality(a, b) > 0, false
+}
+
+// quarantineName returns where a file is moved to when it is quarantined, without overwriting anything.
+func (opts CollisionOptions) quarantineName(fileName string, claimed map[string]int) string {
+	quarantineDir := opts.QuarantineDir
+	if quarantineDir == "" {
+		quarantineDir = DefaultQuarantineDir
+	}
+	if !filepath.IsAbs(quarantineDir) {
+		quarantineDir = filepath.Join(filepath.Dir(fileName), quarantineDir)
+	}
+
+	newFileName := filepath.Join(quarantineDir, filepath.Base(fileName))
+	if _, ok := claimed[foldName(newFileName)]; !ok {
+		if exists, _ := fsutil.Exists(newFileName); !exists {
+			return newFileName
+		}
+	}
+
+	return uniqueFileName(newFileName, claimed)
+}
+
+// hashFile returns the SHA-256 hash of a file's contents.
+func hashFile(fileName string) (string, error) {
+	file, err := fs.Open(fileName)
+	if err != nil {
+		return "", fmt.Errorf("error opening %v", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("error reading %v", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// uniqueFileName adds " (2)", " (3)", etc. to a file name until it is neither claimed nor on disk.
+func uniqueFileName(fileName string, claimed map[string]int) string {
+	extension := filepath.Ext(fileName)
+	base := strings.TrimSuffix(fileName, extension)
+
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%v (%v)%v", base, i, extension)
+		if _, ok := claimed[foldName(candidate)]; ok {
+			continue
+		}
+		if exists, _ := fsutil.Exists(candidate); !exists {
+			return candidate
+		}
+	}
+}
+
+// resolution retrieves the vertical resolution of a video from its file name (e.g. 1080 for "1080p"), or 0 if
+// there isn't one.
+func resolution(fileName string) int {
+	parsed, err := parsetorrentname.Parse(filepath.Base(fileName))
+	if err != nil {
+		return 0
+	}
+
+	if strings.EqualFold(parsed.Resolution, "4k") {
+		return 2160
+	}
+
+	numberRe, _ := regexp.Compile(`\d+`)
+	value, _ := strconv.Atoi(numberRe.FindString(parsed.Resolution))
+	return value
+}
+
+// compareQuality returns a positive number if a is the better copy of an episode than b, a negative number if b is
+// better, and 0 if they can't be told apart. Resolution is compared first, if both names have one, then size.
+func compareQuality(a string, b string) int {
+	resolutionA, resolutionB := resolution(a), resolution(b)
+	if resolutionA != 0 && resolutionB != 0 && resolutionA != resolutionB {
+		return resolutionA - resolutionB
+	}
+
+	var sizeA, sizeB int64
+	if state := statFile(a); state != nil {
+		sizeA = state.Size
+	}
+	if state := statFile(b); state != nil {
+		sizeB = state.Size
+	}
+
+	switch {
+	case sizeA > sizeB:
+		return 1
+	case sizeA < sizeB:
+		return -1
+	}
+	return 0
+}
+
+// takenNames are the names the pending entries of a plan will have once it is applied, so that entries added after
+// collisions have been resolved, such as companions and folders, never take them.
+type takenNames struct {
+	taken     map[string]bool
+	movedAway map[string]bool
+}
+
+// takenNames lists the names taken by the plan, apart from those of the entries left out.
+func (plan Plan) takenNames(leftOut map[string]bool) takenNames {
+	names := takenNames{taken: make(map[string]bool), movedAway: make(map[string]bool)}
+	for _, v := range plan.Entries {
+		if v.Pending() && !leftOut[v.OldFileName] {
+			names.taken[foldName(v.NewFileName)] = true
+			if v.Action.Moves() {
+				names.movedAway[foldName(v.OldFileName)] = true
+			}
+		}
+	}
+
+	return names
+}
+
+// claim gives a pending entry its new name, or skips it if the name is already taken, by the plan or on disk.
+func (names takenNames) claim(entry *PlanEntry) {
+	if !entry.Pending() || entry.Unchanged() {
+		return
+	}
+
+	newFileName := foldName(entry.NewFileName)
+	if names.taken[newFileName] || (!names.movedAway[newFileName] && entry.exists(entry.NewFileName)) {
+		entry.Skip = true
+		entry.Warnings = append(entry.Warnings, fmt.Sprintf("skipped, as %v already exists", entry.NewFileName))
+		return
+	}
+
+	names.taken[newFileName] = true
+	if entry.Action.Moves() {
+		names.movedAway[foldName(entry.OldFileName)] = true
+	}
+}
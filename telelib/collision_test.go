@@ -0,0 +1,306 @@
+package telelib
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+)
+
+func TestResolveCollisions(t *testing.T) {
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: "show.s01e01.720p.mkv", NewFileName: "Show - S01E01 - Pilot.mkv"}},
+		{FileRename: FileRename{OldFileName: "show.s01e01.1080p.mkv", NewFileName: "Show - S01E01 - Pilot.mkv"}},
+		{FileRename: FileRename{OldFileName: "show.s01e02.mkv", NewFileName: "Show - S01E02 - Second.mkv"}},
+		// Third.mkv is renamed before anything else takes its name, so isn't a collision.
+		{FileRename: FileRename{OldFileName: "Show - S01E03 - Third.mkv", NewFileName: "Show - S01E03 - Renamed.mkv"}},
+		{FileRename: FileRename{OldFileName: "show.s01e03.mkv", NewFileName: "Show - S01E03 - Third.mkv"}},
+	}}
+
+	cases := []struct {
+		policy  CollisionPolicy
+		renames []FileRename
+		err     bool
+	}{
+		{
+			CollisionSkip,
+			[]FileRename{
+				{OldFileName: "show.s01e01.720p.mkv", NewFileName: "Show - S01E01 - Pilot.mkv"},
+				{OldFileName: "Show - S01E03 - Third.mkv", NewFileName: "Show - S01E03 - Renamed.mkv"},
+				{OldFileName: "show.s01e03.mkv", NewFileName: "Show - S01E03 - Third.mkv"},
+			},
+			false,
+		},
+		{
+			CollisionSuffix,
+			[]FileRename{
+				{OldFileName: "show.s01e01.720p.mkv", NewFileName: "Show - S01E01 - Pilot.mkv"},
+				{OldFileName: "show.s01e01.1080p.mkv", NewFileName: "Show - S01E01 - Pilot (2).mkv"},
+				{OldFileName: "show.s01e02.mkv", NewFileName: "Show - S01E02 - Second (3).mkv"},
+				{OldFileName: "Show - S01E03 - Third.mkv", NewFileName: "Show - S01E03 - Renamed.mkv"},
+				{OldFileName: "show.s01e03.mkv", NewFileName: "Show - S01E03 - Third.mkv"},
+			},
+			false,
+		},
+		{
+			CollisionKeepBest,
+			[]FileRename{
+				{OldFileName: "show.s01e01.1080p.mkv", NewFileName: "Show - S01E01 - Pilot.mkv"},
+				{OldFileName: "Show - S01E03 - Third.mkv", NewFileName: "Show - S01E03 - Renamed.mkv"},
+				{OldFileName: "show.s01e03.mkv", NewFileName: "Show - S01E03 - Third.mkv"},
+			},
+			false,
+		},
+		{
+			CollisionFail,
+			[]FileRename{
+				{OldFileName: "show.s01e01.720p.mkv", NewFileName: "Show - S01E01 - Pilot.mkv"},
+				{OldFileName: "Show - S01E03 - Third.mkv", NewFileName: "Show - S01E03 - Renamed.mkv"},
+				{OldFileName: "show.s01e03.mkv", NewFileName: "Show - S01E03 - Third.mkv"},
+			},
+			true,
+		},
+	}
+
+	for _, v := range cases {
+		fs = afero.NewMemMapFs()
+		fsutil = &afero.Afero{Fs: fs}
+
+		for _, entry := range plan.Entries {
+			afero.WriteFile(fs, entry.OldFileName, []byte("random contents"), 0644)
+		}
+		// Already exists, and isn't being renamed, so is a collision. The smaller new file loses with CollisionKeepBest.
+		afero.WriteFile(fs, "Show - S01E02 - Second.mkv", []byte("an even longer random contents"), 0644)
+		afero.WriteFile(fs, "Show - S01E02 - Second (2).mkv", []byte("random contents"), 0644)
+
+		result, err := plan.ResolveCollisions(v.policy)
+		if (err != nil) != v.err {
+			t.Errorf("ResolveCollisions(%v) returned error %v, expected error = %v", v.policy, err, v.err)
+		}
+		if !cmp.Equal(result.Renames(), v.renames) {
+			t.Errorf("ResolveCollisions(%v).Renames() == %+v\n, expected %+v", v.policy, result.Renames(), v.renames)
+		}
+	}
+
+	// The plan given shouldn't be changed.
+	for _, v := range plan.Entries {
+		if !v.Pending() || len(v.Warnings) > 0 {
+			t.Errorf("ResolveCollisions() changed the original plan: %+v", v)
+		}
+	}
+}
+
+func TestCompareQuality(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	afero.WriteFile(fs, "show.s01e01.720p.mkv", []byte("a much longer set of random contents"), 0644)
+	afero.WriteFile(fs, "show.s01e01.1080p.mkv", []byte("random contents"), 0644)
+	afero.WriteFile(fs, "Show - S01E01 - Pilot.mkv", []byte("random"), 0644)
+
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"show.s01e01.1080p.mkv", "show.s01e01.720p.mkv", 1},
+		{"show.s01e01.720p.mkv", "show.s01e01.1080p.mkv", -1},
+		// Without a resolution in both names, size is used instead.
+		{"show.s01e01.1080p.mkv", "Show - S01E01 - Pilot.mkv", 1},
+		{"Show - S01E01 - Pilot.mkv", "show.s01e01.720p.mkv", -1},
+		{"show.s01e01.720p.mkv", "show.s01e01.720p.mkv", 0},
+	}
+
+	for _, v := range cases {
+		result := compareQuality(v.a, v.b)
+		if (result > 0) != (v.want > 0) || (result < 0) != (v.want < 0) {
+			t.Errorf("compareQuality(%q, %q) = %v, expected %v", v.a, v.b, result, v.want)
+		}
+	}
+}
+
+func TestResolveCollisionsQuarantine(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	afero.WriteFile(fs, "show.s01e01.720p.mkv", []byte("random contents"), 0644)
+	afero.WriteFile(fs, "show.s01e01.1080p.mkv", []byte("other contents"), 0644)
+	afero.WriteFile(fs, "show.s01e02.mkv", []byte("a longer random contents"), 0644)
+	afero.WriteFile(fs, "Show - S01E02 - Second.mkv", []byte("random contents"), 0644)
+	afero.WriteFile(fs, "show.s01e03.mkv", []byte("random contents"), 0644)
+	afero.WriteFile(fs, "Show - S01E03 - Third.mkv", []byte("random contents"), 0644)
+
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: "show.s01e01.720p.mkv", NewFileName: "Show - S01E01 - Pilot.mkv"}},
+		{FileRename: FileRename{OldFileName: "show.s01e01.1080p.mkv", NewFileName: "Show - S01E01 - Pilot.mkv"}},
+		{FileRename: FileRename{OldFileName: "show.s01e02.mkv", NewFileName: "Show - S01E02 - Second.mkv"}},
+		{FileRename: FileRename{OldFileName: "show.s01e03.mkv", NewFileName: "Show - S01E03 - Third.mkv"}},
+	}}
+
+	result, err := plan.ResolveCollisionsWithOptions(CollisionOptions{Policy: CollisionQuarantine, QuarantineDir: "dupes", CompareHash: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []FileRename{
+		// The 720p copy loses to the 1080p copy.
+		{OldFileName: "show.s01e01.720p.mkv", NewFileName: filepath.Join("dupes", "show.s01e01.720p.mkv")},
+		{OldFileName: "show.s01e01.1080p.mkv", NewFileName: "Show - S01E01 - Pilot.mkv"},
+		// The existing file is smaller, so is moved out of the way first.
+		{OldFileName: "Show - S01E02 - Second.mkv", NewFileName: filepath.Join("dupes", "Show - S01E02 - Second.mkv")},
+		{OldFileName: "show.s01e02.mkv", NewFileName: "Show - S01E02 - Second.mkv"},
+		// Identical to the existing file, which is kept.
+		{OldFileName: "show.s01e03.mkv", NewFileName: filepath.Join("dupes", "show.s01e03.mkv")},
+	}
+	if !cmp.Equal(result.Renames(), expected) {
+		t.Errorf("ResolveCollisionsWithOptions().Renames() == %+v\n, expected %+v", result.Renames(), expected)
+	}
+
+	renamed, errs := result.Apply()
+	if len(errs) != 0 || len(renamed) != len(expected) {
+		t.Errorf("Apply() renamed %+v, with errors %v", renamed, errs)
+	}
+}
+
+func TestResolveCollisionsKeepBestExisting(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	afero.WriteFile(fs, "Show.S01E01.1080p.mkv", []byte("a much longer set of random contents"), 0644)
+	afero.WriteFile(fs, "Show - S01E01 - Pilot.mkv", []byte("random contents"), 0644)
+
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: "Show.S01E01.1080p.mkv", NewFileName: "Show - S01E01 - Pilot.mkv"}},
+	}}
+
+	result, err := plan.ResolveCollisions(CollisionKeepBest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, errs := result.Apply(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	// The better file takes the name, and the file that had it is kept rather than overwritten.
+	for fileName, want := range map[string]string{
+		"Show - S01E01 - Pilot.mkv":     "a much longer set of random contents",
+		"Show - S01E01 - Pilot (2).mkv": "random contents",
+	} {
+		contents, err := afero.ReadFile(fs, fileName)
+		if err != nil || string(contents) != want {
+			t.Errorf("%v contains %q, %v, expected %q", fileName, contents, err, want)
+		}
+	}
+}
+
+func TestResolveCollisionsKeepBestChain(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	afero.WriteFile(fs, "x.mkv", []byte("x contents"), 0644)
+	afero.WriteFile(fs, "z.mkv", []byte("z contents"), 0644)
+	afero.WriteFile(fs, "w.mkv", []byte("a much longer set of w contents"), 0644)
+
+	// z.mkv takes x.mkv's name once it has moved, so x.mkv has to move even though w.mkv beats it to y.mkv.
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: "x.mkv", NewFileName: "y.mkv"}},
+		{FileRename: FileRename{OldFileName: "z.mkv", NewFileName: "x.mkv"}},
+		{FileRename: FileRename{OldFileName: "w.mkv", NewFileName: "y.mkv"}},
+	}}
+
+	result, err := plan.ResolveCollisions(CollisionKeepBest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, errs := result.Apply(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	for fileName, want := range map[string]string{
+		"y (2).mkv": "x contents",
+		"x.mkv":     "z contents",
+		"y.mkv":     "a much longer set of w contents",
+	} {
+		contents, err := afero.ReadFile(fs, fileName)
+		if err != nil || string(contents) != want {
+			t.Errorf("%v contains %q, %v, expected %q", fileName, contents, err, want)
+		}
+	}
+}
+
+func TestResolveCollisionsUnchanged(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	afero.WriteFile(fs, "shows/Show - S01E01 - Pilot.mkv", []byte("random contents"), 0644)
+
+	// The file already has its new name, written another way, so doesn't collide with itself.
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: "./shows/Show - S01E01 - Pilot.mkv", NewFileName: "shows/Show - S01E01 - Pilot.mkv"}},
+	}}
+
+	for _, policy := range []CollisionPolicy{CollisionSkip, CollisionKeepBest, CollisionQuarantine} {
+		result, err := plan.ResolveCollisions(policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if renames := result.Renames(); len(renames) != 0 || len(result.Entries[0].Warnings) != 0 {
+			t.Errorf("ResolveCollisions(%v) == %+v, expected the file to be left as it is", policy, result.Entries)
+		}
+	}
+}
+
+func TestResolveCollisionsKeepBestCopy(t *testing.T) {
+	for _, policy := range []CollisionPolicy{CollisionKeepBest, CollisionQuarantine} {
+		fs = afero.NewMemMapFs()
+		fsutil = &afero.Afero{Fs: fs}
+
+		afero.WriteFile(fs, "show.s01e01.720p.mkv", []byte("random contents"), 0644)
+		afero.WriteFile(fs, "show.s01e01.1080p.mkv", []byte("other contents"), 0644)
+		afero.WriteFile(fs, "Show.S01E02.1080p.mkv", []byte("a much longer set of random contents"), 0644)
+		afero.WriteFile(fs, "Show - S01E02 - Second.mkv", []byte("random contents"), 0644)
+
+		plan := Plan{Entries: []PlanEntry{
+			{FileRename: FileRename{OldFileName: "show.s01e01.720p.mkv", NewFileName: "Show - S01E01 - Pilot.mkv"}},
+			{FileRename: FileRename{OldFileName: "show.s01e01.1080p.mkv", NewFileName: "Show - S01E01 - Pilot.mkv"}},
+			{FileRename: FileRename{OldFileName: "Show.S01E02.1080p.mkv", NewFileName: "Show - S01E02 - Second.mkv"}},
+		}}.WithAction(ActionCopy)
+
+		result, err := plan.ResolveCollisions(policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The better copy is copied, and the existing file is left as it is rather than moved or replaced.
+		expected := []FileRename{{OldFileName: "show.s01e01.1080p.mkv", NewFileName: "Show - S01E01 - Pilot.mkv", Action: ActionCopy}}
+		if !cmp.Equal(result.Renames(), expected) {
+			t.Errorf("ResolveCollisions(%v).Renames() == %+v\n, expected %+v", policy, result.Renames(), expected)
+		}
+		if _, errs := result.Apply(); len(errs) != 0 {
+			t.Errorf("ResolveCollisions(%v).Apply() returned errors %v", policy, errs)
+		}
+		if contents, _ := afero.ReadFile(fs, "Show - S01E02 - Second.mkv"); string(contents) != "random contents" {
+			t.Errorf("ResolveCollisions(%v).Apply() replaced the existing file with %q", policy, contents)
+		}
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	afero.WriteFile(fs, "a.mkv", []byte("random contents"), 0644)
+	afero.WriteFile(fs, "b.mkv", []byte("random contents"), 0644)
+	afero.WriteFile(fs, "c.mkv", []byte("other contents"), 0644)
+
+	a, _ := hashFile("a.mkv")
+	b, _ := hashFile("b.mkv")
+	c, _ := hashFile("c.mkv")
+	if a != b || a == c {
+		t.Errorf("hashFile() returned %q, %q, %q, expected the first two to match", a, b, c)
+	}
+
+	if _, err := hashFile("missing.mkv"); err == nil {
+		t.Errorf("hashFile(%q) returned no error", "missing.mkv")
+	}
+}
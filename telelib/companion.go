@@ -0,0 +1,121 @@
+package telelib
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// stem is a file name without its folder or extension.
+func stem(fileName string) string {
+	base := filepath.Base(fileName)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// companionSuffix returns what follows a video's name in the name of a companion file, e.g. ".en.forced.srt" or
+// "-thumb.jpg", or false if the file isn't a companion of the video.
+func companionSuffix(video string, fileName string) (string, bool) {
+	if filepath.Dir(video) != filepath.Dir(fileName) {
+		return "", false
+	}
+
+	videoStem := stem(video)
+	base := filepath.Base(fileName)
+	if base == filepath.Base(video) || !strings.HasPrefix(base, videoStem) {
+		return "", false
+	}
+
+	suffix := base[len(videoStem):]
+	if !strings.HasPrefix(suffix, ".") && !strings.HasPrefix(suffix, "-") {
+		return "", false
+	}
+	return suffix, true
+}
+
+// AddCompanions finds the files that share a video's name, such as subtitles ("Episode.en.forced.srt"), metadata
+// ("Episode.nfo") and artwork ("Episode-thumb.jpg"), and adds them to the plan to be renamed along with the video,
+// keeping whatever follows the video's name. Companions that are already in the plan in their own right are moved to
+// follow their video instead, so they can't end up with a different name.
+// Companions should be added after collisions have been resolved, so that they follow their video's final name, and
+// are skipped along with it. Companions whose name is already taken are skipped. Videos that couldn't be looked up
+// keep their companions where they are. A file that could belong to more than one video belongs to the one with the
+// longest name.
+func (plan Plan) AddCompanions(files []string) Plan {
+	return plan.AddCompanionsWithOptions(files, NamingOptions{})
+}
+
+// AddCompanionsWithOptions adds companions as AddCompanions does, keeping their names within the maximum length of
+// the options. The video's name is shortened to make room for whatever follows it, e.g. ".en.forced.srt".
+func (plan Plan) AddCompanionsWithOptions(files []string, opts NamingOptions) Plan {
+	videos := make(map[string]bool)
+	for _, v := range plan.Entries {
+		if v.Error == "" && !v.Folder && !isSubtitle(v.Info.Container) {
+			videos[v.OldFileName] = true
+		}
+	}
+
+	// The video each companion belongs to.
+	companions := make(map[string][]string)
+	owned := make(map[string]bool)
+	for _, file := range files {
+		if videos[file] {
+			continue
+		}
+
+		owner := ""
+		for video := range videos {
+			if _, ok := companionSuffix(video, file); ok && len(video) > len(owner) {
+				owner = video
+			}
+		}
+		if owner != "" {
+			companions[owner] = append(companions[owner], file)
+			owned[file] = true
+		}
+	}
+
+	names := plan.takenNames(owned)
+
+	var withCompanions Plan
+	for _, v := range plan.Entries {
+		if owned[v.OldFileName] {
+			continue
+		}
+		withCompanions.Entries = append(withCompanions.Entries, v)
+
+		if !videos[v.OldFileName] {
+			continue
+		}
+
+		sort.Strings(companions[v.OldFileName])
+		for _, file := range companions[v.OldFileName] {
+			suffix, _ := companionSuffix(v.OldFileName, file)
+			videoStem := stem(v.NewFileName)
+			if len(videoStem)+len(suffix) > opts.maxLength() {
+				videoStem = strings.TrimRight(truncate(videoStem, opts.maxLength()-len(suffix)), " ")
+			}
+			newFileName := filepath.Join(filepath.Dir(v.NewFileName), videoStem+suffix)
+
+			companion := PlanEntry{
+				FileRename: FileRename{OldFileName: file, NewFileName: newFileName, Action: v.Action},
+				Info:       v.Info,
+				Source:     statFile(file),
+			}
+			switch {
+			case !v.Pending():
+				companion.Skip = true
+				companion.Warnings = append(companion.Warnings, fmt.Sprintf("skipped along with %v", v.OldFileName))
+			case videoStem == "":
+				// Nothing of the video's name would be left to tie the companion to it.
+				companion.Skip = true
+				companion.Warnings = append(companion.Warnings, fmt.Sprintf("skipped, as %v is too long to follow %v within %v bytes", suffix, v.NewFileName, opts.maxLength()))
+			}
+			names.claim(&companion)
+
+			withCompanions.Entries = append(withCompanions.Entries, companion)
+		}
+	}
+
+	return withCompanions
+}
@@ -0,0 +1,183 @@
+package telelib
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+)
+
+func TestAddCompanions(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	files := []string{
+		"show.s01e01.mkv",
+		"show.s01e01.en.forced.srt",
+		"show.s01e01.nfo",
+		"show.s01e01-thumb.jpg",
+		"show.s01e01e02.mkv",
+		"show.s01e01e02.srt",
+		"show.s01e03.mkv",
+		"show.s01e03.srt",
+		"unrelated.nfo",
+	}
+	for _, v := range files {
+		afero.WriteFile(fs, v, []byte("random contents"), 0644)
+	}
+
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: "show.s01e01.mkv", NewFileName: "Show - S01E01 - Pilot.mkv"}, Info: ParsedFileInfo{Container: "mkv"}},
+		// Subtitles parsed in their own right shouldn't be able to end up with a different name to their video.
+		{FileRename: FileRename{OldFileName: "show.s01e01.en.forced.srt", NewFileName: "Show - S01E01 - Wrong.srt"}, Info: ParsedFileInfo{Container: "srt"}},
+		{FileRename: FileRename{OldFileName: "show.s01e01e02.mkv", NewFileName: "Show - S01E01-E02 - Pilot.mkv"}, Info: ParsedFileInfo{Container: "mkv"}},
+		// Videos that aren't being renamed keep their companions where they are.
+		{FileRename: FileRename{OldFileName: "show.s01e03.mkv"}, Info: ParsedFileInfo{Container: "mkv"}, Error: "not found"},
+	}}
+
+	result := plan.AddCompanions(files)
+
+	want := []FileRename{
+		{OldFileName: "show.s01e01.mkv", NewFileName: "Show - S01E01 - Pilot.mkv"},
+		{OldFileName: "show.s01e01-thumb.jpg", NewFileName: "Show - S01E01 - Pilot-thumb.jpg"},
+		{OldFileName: "show.s01e01.en.forced.srt", NewFileName: "Show - S01E01 - Pilot.en.forced.srt"},
+		{OldFileName: "show.s01e01.nfo", NewFileName: "Show - S01E01 - Pilot.nfo"},
+		{OldFileName: "show.s01e01e02.mkv", NewFileName: "Show - S01E01-E02 - Pilot.mkv"},
+		{OldFileName: "show.s01e01e02.srt", NewFileName: "Show - S01E01-E02 - Pilot.srt"},
+		{OldFileName: "show.s01e03.mkv"},
+	}
+
+	if len(result.Entries) != len(want) {
+		t.Fatalf("AddCompanions() = %+v, want %+v", result.Entries, want)
+	}
+	for i, v := range want {
+		if result.Entries[i].FileRename != v {
+			t.Errorf("AddCompanions()[%v] = %+v, want %+v", i, result.Entries[i].FileRename, v)
+		}
+	}
+	if result.Entries[1].Source == nil {
+		t.Errorf("AddCompanions() didn't record the state of %v", result.Entries[1].OldFileName)
+	}
+}
+
+func TestAddCompanionsFolders(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	files := []string{
+		filepath.Join("downloads", "show.s01e01.mkv"),
+		filepath.Join("downloads", "show.s01e01.srt"),
+		filepath.Join("elsewhere", "show.s01e01.srt"),
+	}
+
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: files[0], NewFileName: filepath.Join("Show", "Season 01", "Show - S01E01 - Pilot.mkv"), Action: ActionHardlink}, Info: ParsedFileInfo{Container: "mkv"}},
+	}}
+
+	result := plan.AddCompanions(files)
+
+	if len(result.Entries) != 2 {
+		t.Fatalf("AddCompanions() = %+v, want the video and one subtitle", result.Entries)
+	}
+	want := FileRename{OldFileName: files[1], NewFileName: filepath.Join("Show", "Season 01", "Show - S01E01 - Pilot.srt"), Action: ActionHardlink}
+	if result.Entries[1].FileRename != want {
+		t.Errorf("AddCompanions()[1] = %+v, want %+v", result.Entries[1].FileRename, want)
+	}
+}
+
+func TestAddCompanionsMaxLength(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	files := []string{"show.s01e01.mkv", "show.s01e01.en.forced.srt", "show.s01e01.nfo"}
+
+	// The video's name is already as long as it can be.
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: "show.s01e01.mkv", NewFileName: "Show - S01E01 - Help Is.mkv"}, Info: ParsedFileInfo{Container: "mkv"}},
+	}}
+
+	result := plan.AddCompanionsWithOptions(files, NamingOptions{MaxLength: 27})
+
+	want := []FileRename{
+		{OldFileName: "show.s01e01.mkv", NewFileName: "Show - S01E01 - Help Is.mkv"},
+		{OldFileName: "show.s01e01.en.forced.srt", NewFileName: "Show - S01E01.en.forced.srt"},
+		{OldFileName: "show.s01e01.nfo", NewFileName: "Show - S01E01 - Help Is.nfo"},
+	}
+	if len(result.Entries) != len(want) {
+		t.Fatalf("AddCompanionsWithOptions() = %+v, want %+v", result.Entries, want)
+	}
+	for i, v := range want {
+		if result.Entries[i].FileRename != v {
+			t.Errorf("AddCompanionsWithOptions()[%v] = %+v, want %+v", i, result.Entries[i].FileRename, v)
+		}
+		if len(result.Entries[i].NewFileName) > 27 {
+			t.Errorf("AddCompanionsWithOptions()[%v] = %q, which is longer than 27 bytes", i, result.Entries[i].NewFileName)
+		}
+	}
+}
+
+func TestAddCompanionsTooLong(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	files := []string{"show.s01e01.mkv", "show.s01e01.en.sdh.forced.srt"}
+
+	// The subtitle's suffix leaves no room for any of the video's name.
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: "show.s01e01.mkv", NewFileName: "Show - S01E01.mkv"}, Info: ParsedFileInfo{Container: "mkv"}},
+	}}
+
+	result := plan.AddCompanionsWithOptions(files, NamingOptions{MaxLength: 18})
+	if len(result.Entries) != 2 || result.Entries[1].Pending() {
+		t.Errorf("AddCompanionsWithOptions() = %+v, expected the subtitle to be skipped", result.Entries)
+	}
+}
+
+func TestAddCompanionsAfterCollisions(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	files := []string{"b.720p.mkv", "a.1080p.mkv", "a.1080p.en.srt"}
+	for _, v := range files {
+		afero.WriteFile(fs, v, []byte("random contents"), 0644)
+	}
+
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: "b.720p.mkv", NewFileName: "Show - S01E01.mkv"}, Info: ParsedFileInfo{Container: "mkv"}},
+		{FileRename: FileRename{OldFileName: "a.1080p.mkv", NewFileName: "Show - S01E01.mkv"}, Info: ParsedFileInfo{Container: "mkv"}},
+		{FileRename: FileRename{OldFileName: "a.1080p.en.srt", NewFileName: "Show - S01E01.en.srt"}, Info: ParsedFileInfo{Container: "srt"}},
+	}}
+
+	cases := []struct {
+		policy CollisionPolicy
+		want   []FileRename
+	}{
+		// The subtitle is skipped along with its video, rather than ending up with the other video's name.
+		{CollisionSkip, []FileRename{{OldFileName: "b.720p.mkv", NewFileName: "Show - S01E01.mkv"}}},
+		{CollisionSuffix, []FileRename{
+			{OldFileName: "b.720p.mkv", NewFileName: "Show - S01E01.mkv"},
+			{OldFileName: "a.1080p.mkv", NewFileName: "Show - S01E01 (2).mkv"},
+			{OldFileName: "a.1080p.en.srt", NewFileName: "Show - S01E01 (2).en.srt"},
+		}},
+	}
+
+	for _, v := range cases {
+		resolved, err := plan.ResolveCollisions(v.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result := resolved.AddCompanions(files).Renames(); !cmp.Equal(result, v.want) {
+			t.Errorf("AddCompanions() after ResolveCollisions(%v) == %+v, expected %+v", v.policy, result, v.want)
+		}
+	}
+
+	// Companions never take a name that is already taken.
+	afero.WriteFile(fs, "Show - S01E01 (2).en.srt", []byte("random contents"), 0644)
+	resolved, _ := plan.ResolveCollisions(CollisionSuffix)
+	for _, v := range resolved.AddCompanions(files).Entries {
+		if v.OldFileName == "a.1080p.en.srt" && v.Pending() {
+			t.Errorf("AddCompanions() renamed %v onto an existing file", v.OldFileName)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package telelib
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// FileFilter decides which files are renamed.
+type FileFilter struct {
+	// Allow only renames files with these extensions (e.g. "mkv"), and treats them as videos even if their names
+	// don't say so. Everything is allowed if empty.
+	Allow []string
+	// Deny never renames files with these extensions, not even along with a video.
+	Deny []string
+	// Exclude never renames files matching any of these globs (see path.Match), not even along with a video.
+	// Globs are matched against both the name and the path, using "/" between folders.
+	Exclude []string
+	// MinSize skips episodes smaller than this many bytes, such as previews. Files renamed along with a video, such
+	// as subtitles, are never too small.
+	MinSize int64
+	// SkipSamples skips episodes with "sample" in their name.
+	SkipSamples bool
+	// Formatted skips episodes that have already been named with the format, so they aren't looked up again.
+	Formatted *FormatMatcher
+}
+
+// SkippedFile is a file that won't be renamed, and why.
+type SkippedFile struct {
+	FileName string
+	Reason   string
+}
+
+// sampleRe matches "sample" as a word of its own, so "Sample", "ep.sample.mkv" and "ep-sample.mkv" are samples but
+// "Samples of Time" isn't.
+var sampleRe = regexp.MustCompile(`(?i)(^|[^a-z0-9])sample([^a-z0-9]|$)`)
+
+// extension is a file's extension, without the ".".
+func extension(fileName string) string {
+	return strings.TrimPrefix(filepath.Ext(fileName), ".")
+}
+
+// Validate checks every glob in the filter can be matched against.
+func (filter FileFilter) Validate() error {
+	return validateGlobs(filter.Exclude)
+}
+
+// Excludes returns why a file is never renamed, even along with a video, or "" if it may be.
+func (filter FileFilter) Excludes(fileName string) string {
+	if ext := extension(fileName); contains(filter.Deny, ext) {
+		return fmt.Sprintf("extension %q is denied", ext)
+	}
+
+	if glob := matchesGlob(filter.Exclude, fileName); glob != "" {
+		return fmt.Sprintf("excluded by %q", glob)
+	}
+
+	return ""
+}
+
+// Skips returns why a file isn't renamed as an episode in its own right, or "" if it may be.
+func (filter FileFilter) Skips(fileName string) string {
+	if reason := filter.Excludes(fileName); reason != "" {
+		return reason
+	}
+
+	if ext := extension(fileName); len(filter.Allow) > 0 && !contains(filter.Allow, ext) {
+		return fmt.Sprintf("extension %q is not allowed", ext)
+	}
+
+	if filter.SkipSamples && sampleRe.MatchString(stem(fileName)) {
+		return "sample file"
+	}
+
+	if filter.Formatted != nil && filter.Formatted.Matches(fileName) {
+		return "already named with the format"
+	}
+
+	if filter.MinSize > 0 {
+		if state := statFile(fileName); state != nil && state.Size < filter.MinSize {
+			return fmt.Sprintf("smaller than %v bytes", filter.MinSize)
+		}
+	}
+
+	return ""
+}
+
+// Companions returns the files that may be renamed along with a video, as with Plan.AddCompanions.
+func (filter FileFilter) Companions(files []string) []string {
+	var companions []string
+	for _, v := range files {
+		if filter.Excludes(v) == "" {
+			companions = append(companions, v)
+		}
+	}
+
+	return companions
+}
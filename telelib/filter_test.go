@@ -0,0 +1,87 @@
+package telelib
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+)
+
+func TestFileFilter(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	afero.WriteFile(fs, "big.s01e01.mkv", make([]byte, 2048), 0644)
+	afero.WriteFile(fs, "small.s01e02.mkv", make([]byte, 16), 0644)
+
+	filter := FileFilter{Allow: []string{"mkv"}, Deny: []string{"txt"}, Exclude: []string{"*.part"}, MinSize: 1024, SkipSamples: true}
+
+	cases := []struct {
+		fileName string
+		excludes string
+		skips    string
+	}{
+		{"big.s01e01.mkv", "", ""},
+		{"small.s01e02.mkv", "", "smaller than 1024 bytes"},
+		{"show.s01e03.sample.mkv", "", "sample file"},
+		{"Samples.of.Time.s01e03.mkv", "", ""},
+		{"show.s01e04.en.srt", "", `extension "srt" is not allowed`},
+		{"show.s01e05.txt", `extension "txt" is denied`, `extension "txt" is denied`},
+		{"show.s01e06.mkv.part", `excluded by "*.part"`, `excluded by "*.part"`},
+	}
+
+	for _, v := range cases {
+		if result := filter.Excludes(v.fileName); result != v.excludes {
+			t.Errorf("Excludes(%q) == %q, expected %q", v.fileName, result, v.excludes)
+		}
+		if result := filter.Skips(v.fileName); result != v.skips {
+			t.Errorf("Skips(%q) == %q, expected %q", v.fileName, result, v.skips)
+		}
+	}
+
+	companions := filter.Companions([]string{"show.s01e04.en.srt", "show.s01e05.txt", "show.s01e06.mkv.part"})
+	if want := []string{"show.s01e04.en.srt"}; !cmp.Equal(companions, want) {
+		t.Errorf("Companions() == %q, expected %q", companions, want)
+	}
+
+	if err := (FileFilter{Exclude: []string{"["}}).Validate(); err == nil {
+		t.Errorf("Validate() accepted an invalid exclude glob")
+	}
+}
+
+func TestParseFilesWithOptions(t *testing.T) {
+	fileList := []string{"the.good.place.s01e01.mkv", "the.good.place.s01e02.ts", "the.good.place.s01e03.sample.mkv", "poster.jpg"}
+
+	result, skipped := ParseFilesWithOptions(fileList, ParseOptions{Filter: FileFilter{SkipSamples: true}})
+	var parsed []string
+	for _, v := range result {
+		parsed = append(parsed, v.FileName)
+	}
+	if want := []string{"the.good.place.s01e01.mkv"}; !cmp.Equal(parsed, want) {
+		t.Errorf("ParseFilesWithOptions() parsed %q, expected %q", parsed, want)
+	}
+
+	wantSkipped := []SkippedFile{
+		{"the.good.place.s01e02.ts", "not a video or subtitle"},
+		{"the.good.place.s01e03.sample.mkv", "sample file"},
+		{"poster.jpg", "not a video or subtitle"},
+	}
+	if !cmp.Equal(skipped, wantSkipped) {
+		t.Errorf("ParseFilesWithOptions() skipped %+v, expected %+v", skipped, wantSkipped)
+	}
+
+	matcher, err := NewFormatMatcher("{s} - S{0z}E{0e} - {n}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, skipped = ParseFilesWithOptions([]string{"The Good Place - S01E01 - Everything Is Fine.mkv"}, ParseOptions{Filter: FileFilter{Formatted: &matcher}})
+	if want := []SkippedFile{{"The Good Place - S01E01 - Everything Is Fine.mkv", "already named with the format"}}; !cmp.Equal(skipped, want) {
+		t.Errorf("ParseFilesWithOptions() skipped %+v, expected %+v", skipped, want)
+	}
+
+	// Allowing an extension treats it as a video.
+	result, _ = ParseFilesWithOptions(fileList, ParseOptions{Filter: FileFilter{Allow: []string{"ts"}}})
+	if len(result) != 1 || result[0].FileName != "the.good.place.s01e02.ts" || result[0].Container != "ts" {
+		t.Errorf("ParseFilesWithOptions() with ts allowed == %+v, expected the.good.place.s01e02.ts", result)
+	}
+}
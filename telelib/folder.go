@@ -0,0 +1,217 @@
+package telelib
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SeasonFolderTokens are the tokens understood by season folder formats. Only the series and season are shared by
+// every episode within a season folder.
+var SeasonFolderTokens = []string{"{s}", "{z}", "{0z}"}
+
+// SeriesFolderTokens are the tokens understood by series folder formats, which hold every season of a series.
+var SeriesFolderTokens = []string{"{s}"}
+
+// validateFolderFormat checks that a folder format only contains the given tokens, and names a single folder.
+func validateFolderFormat(format string, tokens []string) error {
+	if err := ValidateFormat(format); err != nil {
+		return err
+	}
+
+	var unknown []string
+	for _, token := range tokenRe.FindAllString(format, -1) {
+		if !contains(tokens, token) {
+			unknown = append(unknown, token)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("tokens %v can't be used in folder format %q, expected any of %v", unknown, format, tokens)
+	}
+
+	if strings.Contains(format, "/") {
+		return fmt.Errorf("folder format %q can only name a single folder", format)
+	}
+
+	return nil
+}
+
+// FolderOptions changes how RenameFolders names folders.
+type FolderOptions struct {
+	// SeasonFormat names folders holding a single season of a series, e.g. "Season {0z}". Season folders are left
+	// as they are if empty.
+	SeasonFormat string
+	// SeriesFormat names folders holding a series, either directly or within season folders, e.g. "{s}". Series
+	// folders are left as they are if empty.
+	SeriesFormat string
+	// Naming cleans up folder names, as it does file names.
+	Naming NamingOptions
+}
+
+// Validate checks that the season folder format only contains tokens in SeasonFolderTokens, and the series folder
+// format only those in SeriesFolderTokens, and that each names a single folder.
+func (opts FolderOptions) Validate() error {
+	if opts.SeasonFormat != "" {
+		if err := validateFolderFormat(opts.SeasonFormat, SeasonFolderTokens); err != nil {
+			return err
+		}
+	}
+	if opts.SeriesFormat != "" {
+		if err := validateFolderFormat(opts.SeriesFormat, SeriesFolderTokens); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// folderContents is what is known about a folder from the entries within it.
+type folderContents struct {
+	info    ParsedFileInfo
+	seasons map[int]bool
+	// mixed is set if the folder holds more than one series, or entries that aren't renamed within it.
+	mixed bool
+}
+
+// RenameFolders adds entries to the plan renaming the folders episodes are in, such as
+// "Show.S02.1080p.WEB-DL.x264-GROUP", named from the episodes within them, after the episodes themselves.
+// A season folder holds episodes of a single season, and a series folder holds either season folders of a single
+// series and no episodes, or episodes from several seasons of a single series. Folders are only renamed when every
+// entry within them is renamed in place, and every folder within a series folder is one of its season folders, so
+// that folders holding anything else, such as a library, are left as they are. Folders within a folder of episodes,
+// such as extras, are left as they are too. Season folders come before series folders, so that undoing the plan
+// renames them back in the right order.
+func (plan Plan) RenameFolders(opts FolderOptions) Plan {
+	folders := make(map[string]*folderContents)
+	for _, v := range plan.Entries {
+		if v.Folder {
+			continue
+		}
+
+		dir := filepath.Dir(v.OldFileName)
+		contents := folders[dir]
+		if contents == nil {
+			contents = &folderContents{info: ParsedFileInfo{FileName: dir, Series: v.Info.Series, Season: v.Info.Season}, seasons: make(map[int]bool)}
+			folders[dir] = contents
+		}
+
+		// Entries already named correctly are still in place.
+		inPlace := v.Pending() || (v.Error == "" && v.Unchanged())
+		if !inPlace || !v.Action.Moves() || filepath.Dir(v.NewFileName) != dir || v.Info.Series != contents.info.Series {
+			contents.mixed = true
+		}
+		contents.seasons[v.Info.Season] = true
+	}
+
+	seasons := make(map[string]ParsedFileInfo)
+	for dir, contents := range folders {
+		// Folders within a folder of episodes are more likely to be extras than seasons.
+		if _, nested := folders[filepath.Dir(dir)]; nested {
+			continue
+		}
+		if !contents.mixed && len(contents.seasons) == 1 && renamableFolder(dir) {
+			seasons[dir] = contents.info
+		}
+	}
+
+	series := make(map[string]ParsedFileInfo)
+	for dir, contents := range folders {
+		if !contents.mixed && len(contents.seasons) > 1 && renamableFolder(dir) && onlySeasonFolders(dir, contents.info.Series, seasons) {
+			series[dir] = ParsedFileInfo{FileName: dir, Series: contents.info.Series}
+		}
+	}
+	for dir, info := range seasons {
+		parent := filepath.Dir(dir)
+		if _, ok := folders[parent]; !ok && renamableFolder(parent) && onlySeasonFolders(parent, info.Series, seasons) {
+			series[parent] = ParsedFileInfo{FileName: parent, Series: info.Series}
+		}
+	}
+
+	var folderList []PlanEntry
+	if opts.SeasonFormat != "" {
+		folderList = append(folderList, folderEntries(seasons, opts.SeasonFormat, opts.Naming)...)
+	}
+	if opts.SeriesFormat != "" {
+		folderList = append(folderList, folderEntries(series, opts.SeriesFormat, opts.Naming)...)
+	}
+
+	// Folders are added after collisions have been resolved, so are checked against everything else themselves.
+	names := plan.takenNames(nil)
+	renamed := Plan{Entries: append([]PlanEntry(nil), plan.Entries...)}
+	for _, v := range folderList {
+		names.claim(&v)
+		renamed.Entries = append(renamed.Entries, v)
+	}
+
+	return renamed
+}
+
+// folderEntries names every folder with a folder format, in order, leaving out those already named correctly.
+func folderEntries(folders map[string]ParsedFileInfo, format string, opts NamingOptions) []PlanEntry {
+	var dirs []string
+	for dir := range folders {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	var entries []PlanEntry
+	for _, dir := range dirs {
+		info := folders[dir]
+		p := ParsedFileInfo{Series: opts.replace(opts.normalize(info.Series)), Season: info.Season}
+		name := p.fitSegment(format, 0, opts)
+
+		newDir := filepath.Join(filepath.Dir(dir), name)
+		if name == "" || newDir == dir {
+			continue
+		}
+
+		entries = append(entries, PlanEntry{
+			FileRename: FileRename{OldFileName: dir, NewFileName: newDir, Action: ActionRename},
+			Info:       info,
+			Source:     statFile(dir),
+			Folder:     true,
+		})
+	}
+
+	return entries
+}
+
+// onlySeasonFolders reports whether every folder within a folder is a season folder of the series.
+func onlySeasonFolders(dir string, series string, seasons map[string]ParsedFileInfo) bool {
+	files, err := fsutil.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+
+	for _, v := range files {
+		if !v.IsDir() {
+			continue
+		}
+		if info, ok := seasons[filepath.Join(dir, v.Name())]; !ok || info.Series != series {
+			return false
+		}
+	}
+
+	return true
+}
+
+// renamableFolder reports whether a folder can be renamed at all: it has a name of its own, and isn't the current
+// directory or one of the folders it is within.
+func renamableFolder(dir string) bool {
+	base := filepath.Base(dir)
+	if base == "." || base == ".." || filepath.Dir(dir) == dir {
+		return false
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	current, err := filepath.Abs(".")
+	if err != nil {
+		return false
+	}
+
+	return current != abs && !strings.HasPrefix(current, abs+string(filepath.Separator))
+}
@@ -0,0 +1,159 @@
+package telelib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+)
+
+// episodeEntry renames a file within its own folder, as an episode of the series and season.
+func episodeEntry(oldFileName string, newName string, series string, season int) PlanEntry {
+	oldFileName = filepath.FromSlash(oldFileName)
+	return PlanEntry{
+		FileRename: FileRename{OldFileName: oldFileName, NewFileName: filepath.Join(filepath.Dir(oldFileName), newName), Action: ActionRename},
+		Info:       ParsedFileInfo{FileName: oldFileName, Series: series, Season: season},
+	}
+}
+
+func TestRenameFolders(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	for _, v := range []string{
+		"shows/the.good.place/The.Good.Place.S01.1080p/a.mkv",
+		"shows/the.good.place/The.Good.Place.S02.720p/b.mkv",
+		"shows/the.good.place/The.Good.Place.S02.720p/b.en.srt",
+		"shows/Pack/c.mkv",
+		"shows/Pack/d.mkv",
+		"shows/Mixed/e.mkv",
+		"shows/Mixed/f.mkv",
+		"shows/Season 01/g.mkv",
+		"shows/Season 01/Extras/h.mkv",
+	} {
+		afero.WriteFile(fs, filepath.FromSlash(v), []byte("random contents"), 0644)
+	}
+
+	plan := Plan{Entries: []PlanEntry{
+		episodeEntry("shows/the.good.place/The.Good.Place.S01.1080p/a.mkv", "The Good Place - S01E01.mkv", "The Good Place", 1),
+		episodeEntry("shows/the.good.place/The.Good.Place.S02.720p/b.mkv", "The Good Place - S02E01.mkv", "The Good Place", 2),
+		episodeEntry("shows/the.good.place/The.Good.Place.S02.720p/b.en.srt", "The Good Place - S02E01.en.srt", "The Good Place", 2),
+		// Several seasons in one folder make a series folder.
+		episodeEntry("shows/Pack/c.mkv", "Brooklyn Nine-Nine - S01E01.mkv", "Brooklyn Nine-Nine", 1),
+		episodeEntry("shows/Pack/d.mkv", "Brooklyn Nine-Nine - S02E01.mkv", "Brooklyn Nine-Nine", 2),
+		// Folders with more than one series are left as they are.
+		episodeEntry("shows/Mixed/e.mkv", "The Good Place - S01E01.mkv", "The Good Place", 1),
+		episodeEntry("shows/Mixed/f.mkv", "Brooklyn Nine-Nine - S01E01.mkv", "Brooklyn Nine-Nine", 1),
+		// Already named correctly, with extras that aren't a season of their own.
+		episodeEntry("shows/Season 01/g.mkv", "Community - S01E01.mkv", "Community", 1),
+		episodeEntry("shows/Season 01/Extras/h.mkv", "Community - S01E02.mkv", "Community", 1),
+	}}
+
+	renamed := plan.RenameFolders(FolderOptions{SeasonFormat: "Season {0z}", SeriesFormat: "{s}"})
+
+	var result []FileRename
+	for _, v := range renamed.Entries[len(plan.Entries):] {
+		if !v.Folder {
+			t.Errorf("RenameFolders() added %v, which isn't a folder", v.OldFileName)
+		}
+		result = append(result, v.FileRename)
+	}
+
+	folder := func(oldFileName string, newFileName string) FileRename {
+		return FileRename{OldFileName: filepath.FromSlash(oldFileName), NewFileName: filepath.FromSlash(newFileName), Action: ActionRename}
+	}
+	want := []FileRename{
+		folder("shows/the.good.place/The.Good.Place.S01.1080p", "shows/the.good.place/Season 01"),
+		folder("shows/the.good.place/The.Good.Place.S02.720p", "shows/the.good.place/Season 02"),
+		folder("shows/Pack", "shows/Brooklyn Nine-Nine"),
+		folder("shows/the.good.place", "shows/The Good Place"),
+	}
+	if !cmp.Equal(result, want) {
+		t.Errorf("RenameFolders() == %v, expected %v", result, want)
+	}
+
+	// Folders with entries that aren't renamed in place are left as they are.
+	moved := plan.WithAction(ActionCopy).RenameFolders(FolderOptions{SeasonFormat: "Season {0z}", SeriesFormat: "{s}"})
+	if len(moved.Entries) != len(plan.Entries) {
+		t.Errorf("RenameFolders() renamed folders of copied files: %v", moved.Entries[len(plan.Entries):])
+	}
+}
+
+func TestFolderOptionsValidate(t *testing.T) {
+	cases := []struct {
+		opts  FolderOptions
+		valid bool
+	}{
+		{FolderOptions{SeasonFormat: "Season {0z}"}, true},
+		{FolderOptions{SeasonFormat: "{s} Season {z}", SeriesFormat: "{s}"}, true},
+		{FolderOptions{SeasonFormat: "Season {0z} - {n}"}, false},
+		{FolderOptions{SeasonFormat: "{s}/Season {z}"}, false},
+		{FolderOptions{SeasonFormat: "Season {0z"}, false},
+		// Series folders hold every season, so have no season of their own.
+		{FolderOptions{SeriesFormat: "{s} S{0z}"}, false},
+		{FolderOptions{SeriesFormat: "{s} ({z} seasons)"}, false},
+		{FolderOptions{}, true},
+	}
+
+	for _, v := range cases {
+		if err := v.opts.Validate(); (err == nil) != v.valid {
+			t.Errorf("%+v.Validate() == %v, expected valid: %v", v.opts, err, v.valid)
+		}
+	}
+}
+
+func TestApplyRenameFolders(t *testing.T) {
+	// Afero's memory filesystem doesn't move what is within a folder when it is renamed.
+	dir, err := ioutil.TempDir("", "telenamer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs = afero.NewOsFs()
+	fsutil = &afero.Afero{Fs: fs}
+	defer func() {
+		fs = afero.NewMemMapFs()
+		fsutil = &afero.Afero{Fs: fs}
+	}()
+
+	show := filepath.Join(dir, "the.good.place")
+	oldFileName := filepath.Join(show, "The.Good.Place.S01.1080p", "a.mkv")
+	fs.MkdirAll(filepath.Dir(oldFileName), 0755)
+	afero.WriteFile(fs, oldFileName, []byte("random contents"), 0644)
+
+	plan := Plan{Entries: []PlanEntry{episodeEntry(oldFileName, "The Good Place - S01E01.mkv", "The Good Place", 1)}}
+	plan = plan.RenameFolders(FolderOptions{SeasonFormat: "Season {0z}", SeriesFormat: "{s}"})
+
+	journalPath := filepath.Join(dir, "journal.jsonl")
+	renames, errs := plan.ApplyWithOptions(ApplyOptions{JournalPath: journalPath})
+	if len(errs) > 0 || len(renames) != 3 {
+		t.Fatalf("ApplyWithOptions() == %v, %v, expected 3 renames", renames, errs)
+	}
+
+	newFileName := filepath.Join(dir, "The Good Place", "Season 01", "The Good Place - S01E01.mkv")
+	if exists, _ := fsutil.Exists(newFileName); !exists {
+		t.Fatalf("%v doesn't exist after renaming folders", newFileName)
+	}
+
+	records, err := ReadJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed, _ := ReconcileJournal(records)
+	journal, err := ResumeJournal(journalPath, completed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	if errs := journal.Rollback(); len(errs) > 0 {
+		t.Fatalf("Rollback() == %v", errs)
+	}
+	if exists, _ := fsutil.Exists(oldFileName); !exists {
+		t.Errorf("%v doesn't exist after undoing", oldFileName)
+	}
+}
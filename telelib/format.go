@@ -0,0 +1,175 @@
+package telelib
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FormatTokens are the tokens understood by NewFileName.
+var FormatTokens = []string{"{s}", "{n}", "{e}", "{0e}", "{le}", "{0le}", "{z}", "{0z}", "{m}", "{lang}", "{subflags}"}
+
+// SampleFileInfo is used to preview a format when no other information is given.
+var SampleFileInfo = ParsedFileInfo{
+	FileName:    "The.Good.Place.S04E07.1080p.WEB.x264.mkv",
+	Container:   "mkv",
+	Season:      4,
+	Episode:     7,
+	EpisodeName: "Help Is Other People",
+	Series:      "The Good Place",
+}
+
+// tokenRe matches anything that looks like a token within a format.
+var tokenRe = regexp.MustCompile(`\{[^{}]*\}`)
+
+// ValidateFormat checks that a format only contains tokens NewFileName understands, so that typos such as {se}
+// are reported rather than ending up in file names.
+func ValidateFormat(format string) error {
+	var unknown []string
+	for _, token := range tokenRe.FindAllString(format, -1) {
+		if !isFormatToken(token) {
+			unknown = append(unknown, token)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown tokens %v in format %q, expected any of %v", unknown, format, FormatTokens)
+	}
+
+	// Anything left after removing the tokens shouldn't have braces, otherwise a token has not been closed.
+	if strings.ContainsAny(tokenRe.ReplaceAllString(format, ""), "{}") {
+		return fmt.Errorf("unmatched brace in format %q", format)
+	}
+
+	return nil
+}
+
+func isFormatToken(token string) bool {
+	for _, v := range FormatTokens {
+		if token == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSample builds episode information to preview a format with, from a list of key=value pairs.
+// Anything not given is taken from SampleFileInfo. Keys are series, name, season, episode, lastepisode, container,
+// lang and subflags.
+func ParseSample(pairs []string) (ParsedFileInfo, error) {
+	sample := SampleFileInfo
+
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return ParsedFileInfo{}, fmt.Errorf("sample %q is not in the format key=value", pair)
+		}
+
+		var err error
+		switch strings.ToLower(kv[0]) {
+		case "series":
+			sample.Series = kv[1]
+		case "name":
+			sample.EpisodeName = kv[1]
+		case "container":
+			sample.Container = kv[1]
+		case "season":
+			sample.Season, err = strconv.Atoi(kv[1])
+		case "episode":
+			sample.Episode, err = strconv.Atoi(kv[1])
+		case "lastepisode":
+			sample.LastEpisode, err = strconv.Atoi(kv[1])
+		case "lang":
+			sample.Language = kv[1]
+		case "subflags":
+			sample.SubFlags = kv[1]
+		default:
+			return ParsedFileInfo{}, fmt.Errorf("unknown sample key %q, expected series, name, season, episode, lastepisode, container, lang or subflags", kv[0])
+		}
+
+		if err != nil {
+			return ParsedFileInfo{}, fmt.Errorf("sample %q is not a number: %v", pair, err)
+		}
+	}
+
+	return sample, nil
+}
+
+// formatTokenPatterns are what each token can have become within a file name.
+var formatTokenPatterns = map[string]string{
+	"{s}":        `[^/]+?`,
+	"{n}":        `[^/]+?`,
+	"{e}":        `\d+`,
+	"{0e}":       `\d{2,}`,
+	"{le}":       `\d+`,
+	"{0le}":      `\d{2,}`,
+	"{z}":        `\d+`,
+	"{0z}":       `\d{2,}`,
+	"{m}":        `(?:-?E\d+)?`,
+	"{lang}":     `[^/.]*`,
+	"{subflags}": `[^/]*`,
+}
+
+// FormatMatcher recognises files that have already been named with a format, without looking anything up.
+type FormatMatcher struct {
+	patterns []*regexp.Regexp
+	// folders is how many folders each format has.
+	folders []int
+}
+
+// NewFormatMatcher builds a matcher for files named with any of the formats, such as those of a preset.
+func NewFormatMatcher(formats ...string) (FormatMatcher, error) {
+	var matcher FormatMatcher
+	for _, format := range formats {
+		if err := ValidateFormat(format); err != nil {
+			return FormatMatcher{}, err
+		}
+
+		pattern := "^"
+		last := 0
+		for _, loc := range tokenRe.FindAllStringIndex(format, -1) {
+			pattern += regexp.QuoteMeta(format[last:loc[0]]) + formatTokenPatterns[format[loc[0]:loc[1]]]
+			last = loc[1]
+		}
+		pattern += regexp.QuoteMeta(format[last:]) + "$"
+
+		matcher.patterns = append(matcher.patterns, regexp.MustCompile(pattern))
+		matcher.folders = append(matcher.folders, strings.Count(format, "/"))
+	}
+
+	return matcher, nil
+}
+
+// Matches reports whether a file looks like it was named with one of the formats. Formats with folders are matched
+// against the folders the file is in, too. Subtitles may have their language and flags after the format.
+func (matcher FormatMatcher) Matches(fileName string) bool {
+	fileName = filepath.ToSlash(fileName)
+	ext := path.Ext(fileName)
+	if ext == "" {
+		return false
+	}
+
+	names := []string{strings.TrimSuffix(fileName, ext)}
+	if isSubtitle(ext[1:]) {
+		for i := 0; i < 2; i++ {
+			name := names[len(names)-1]
+			names = append(names, strings.TrimSuffix(name, path.Ext(name)))
+		}
+	}
+
+	for i, pattern := range matcher.patterns {
+		for _, name := range names {
+			segments := strings.Split(name, "/")
+			if len(segments) <= matcher.folders[i] {
+				continue
+			}
+			if pattern.MatchString(strings.Join(segments[len(segments)-matcher.folders[i]-1:], "/")) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,96 @@
+package telelib
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateFormat(t *testing.T) {
+	cases := []struct {
+		in    string
+		valid bool
+	}{
+		{"{s} - S{0z}E{0e} - {n}", true},
+		{"{s}/Season {0z}/{s} - S{0z}E{0e}{m} - {n}", true},
+		{"{z}x{e}-{le}", true},
+		{"No tokens at all", true},
+		{"{s} - {se}", false},
+		{"{s} - {S}", false},
+		{"{s} - S{0z", false},
+		{"{s}} - {n}", false},
+	}
+
+	for _, v := range cases {
+		err := ValidateFormat(v.in)
+		if (err == nil) != v.valid {
+			t.Errorf("ValidateFormat(%q) = %v, expected valid = %v", v.in, err, v.valid)
+		}
+	}
+}
+
+func TestParseSample(t *testing.T) {
+	cases := []struct {
+		in   []string
+		want ParsedFileInfo
+	}{
+		{
+			nil,
+			SampleFileInfo,
+		},
+		{
+			[]string{"series=Star Trek: Picard", "season=1", "episode=1", "lastepisode=2", "name=Remembrance", "container=mp4"},
+			ParsedFileInfo{FileName: SampleFileInfo.FileName, Container: "mp4", Season: 1, Episode: 1, LastEpisode: 2, EpisodeName: "Remembrance", Series: "Star Trek: Picard"},
+		},
+	}
+
+	for _, v := range cases {
+		result, err := ParseSample(v.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != v.want {
+			t.Errorf("ParseSample(%q) = %+v, expected %+v", v.in, result, v.want)
+		}
+	}
+
+	for _, in := range []string{"season=one", "year=2020", "series"} {
+		if _, err := ParseSample([]string{in}); err == nil {
+			t.Errorf("ParseSample(%q) returned no error", in)
+		}
+	}
+}
+
+func TestFormatMatcher(t *testing.T) {
+	cases := []struct {
+		formats []string
+		in      string
+		want    bool
+	}{
+		{[]string{"{s} - S{0z}E{0e} - {n}"}, "The Good Place - S04E07 - Help Is Other People.mkv", true},
+		{[]string{"{s} - S{0z}E{0e}{m} - {n}"}, "shows/The Good Place - S04E07-E08 - Help Is Other People.mkv", true},
+		{[]string{"{s} - S{0z}E{0e} - {n}"}, "The.Good.Place.S04E07.1080p.WEB.x264.mkv", false},
+		{[]string{"{s} - S{0z}E{0e} - {n}"}, "The Good Place - S4E7 - Help Is Other People.mkv", false},
+		{[]string{"{s} - S{0z}E{0e} - {n}"}, "The Good Place - S04E07 - Help Is Other People", false},
+		// Subtitles keep their language and flags.
+		{[]string{"{s} - S{0z}E{0e}"}, "The Good Place - S04E07.en.forced.srt", true},
+		{[]string{"{s} - S{0z}E{0e}"}, "The Good Place - S04E07.en.forced.mkv", false},
+		// Formats with folders need the folders to match too.
+		{[]string{"{s}/Season {0z}/{s} - S{0z}E{0e}"}, "tv/The Good Place/Season 04/The Good Place - S04E07.mkv", true},
+		{[]string{"{s}/Season {0z}/{s} - S{0z}E{0e}"}, "downloads/The Good Place - S04E07.mkv", false},
+		{[]string{Presets["plex"].Format, Presets["plex"].SpecialsFormat}, "The Good Place/Specials/The Good Place - S00E01 - Extra.mkv", true},
+	}
+
+	for _, v := range cases {
+		matcher, err := NewFormatMatcher(v.formats...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result := matcher.Matches(filepath.FromSlash(v.in)); result != v.want {
+			t.Errorf("NewFormatMatcher(%q).Matches(%q) = %v, expected %v", v.formats, v.in, result, v.want)
+		}
+	}
+
+	if _, err := NewFormatMatcher("{s} - {se}"); err == nil {
+		t.Errorf("NewFormatMatcher() accepted an unknown token")
+	}
+}
@@ -0,0 +1,158 @@
+package telelib
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Operation is a single run of renames within a directory, which can be undone.
+type Operation struct {
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	Directory string    `json:"directory"`
+	// Targets are the folders holding the files that were renamed, which may be somewhere other than Directory.
+	Targets []string `json:"targets,omitempty"`
+}
+
+// PerformedIn reports whether an operation was performed within a directory, either from it or on the files in it.
+// Operations with no directory, such as those imported from older versions, could have been performed anywhere.
+func (op Operation) PerformedIn(directory string) bool {
+	return op.Directory == "" || op.Directory == directory || contains(op.Targets, directory)
+}
+
+// History stores every operation, newest last, so that any of them can be undone. Each operation is kept as a
+// JSON file describing it, alongside the journal of its renames.
+type History struct {
+	// Dir is the folder the history is kept in.
+	Dir string
+}
+
+// Start adds a new operation for a directory to the history, renaming files within the target folders. Its renames
+// should be journalled to JournalPath.
+func (history History) Start(directory string, targets ...string) (Operation, error) {
+	return history.start(directory, targets, time.Now())
+}
+
+// start adds an operation performed at a given time to the history.
+func (history History) start(directory string, targets []string, performed time.Time) (Operation, error) {
+	op := Operation{
+		// IDs sort in the order operations were performed.
+		ID:        performed.UTC().Format("20060102T150405.000000000"),
+		Time:      performed,
+		Directory: directory,
+		Targets:   targets,
+	}
+
+	if err := fs.MkdirAll(history.Dir, 0755); err != nil {
+		return Operation{}, fmt.Errorf("error creating history folder %v", err)
+	}
+
+	opJSON, err := json.Marshal(op)
+	if err != nil {
+		return Operation{}, fmt.Errorf("error converting operation to JSON %v", err)
+	}
+	if err := fsutil.WriteFile(filepath.Join(history.Dir, op.ID+".json"), opJSON, 0644); err != nil {
+		return Operation{}, fmt.Errorf("error writing history %v", err)
+	}
+
+	return op, nil
+}
+
+// Import adds renames performed without a journal to the history, as a single operation performed at the given
+// time, so that it keeps its place among the operations performed since. The state of the renamed files isn't
+// known, as their paths may be relative to another directory, so isn't recorded.
+func (history History) Import(directory string, renames []FileRename, performed time.Time) (Operation, error) {
+	op, err := history.start(directory, nil, performed)
+	if err != nil {
+		return Operation{}, err
+	}
+
+	journal, err := OpenJournal(history.JournalPath(op))
+	if err != nil {
+		return Operation{}, err
+	}
+	defer journal.Close()
+
+	for _, v := range renames {
+		journal.add(v, nil)
+		if err := journal.write(v, JournalDone); err != nil {
+			return Operation{}, err
+		}
+	}
+
+	return op, nil
+}
+
+// JournalPath is where the renames of an operation are journalled.
+func (history History) JournalPath(op Operation) string {
+	return filepath.Join(history.Dir, op.ID+".jsonl")
+}
+
+// Operations lists the operations performed within a directory, newest first, as with Operation.PerformedIn.
+// Every operation is listed if directory is empty.
+func (history History) Operations(directory string) ([]Operation, error) {
+	files, err := fsutil.ReadDir(history.Dir)
+	if err != nil {
+		if exists, _ := fsutil.DirExists(history.Dir); !exists {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading history %v", err)
+	}
+
+	var ops []Operation
+	for _, v := range files {
+		if v.IsDir() || !strings.HasSuffix(v.Name(), ".json") {
+			continue
+		}
+
+		opJSON, err := fsutil.ReadFile(filepath.Join(history.Dir, v.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading history %v", err)
+		}
+		var op Operation
+		if err := json.Unmarshal(opJSON, &op); err != nil {
+			return nil, fmt.Errorf("error parsing history %v: %v", v.Name(), err)
+		}
+
+		if directory == "" || op.PerformedIn(directory) {
+			ops = append(ops, op)
+		}
+	}
+
+	sort.Slice(ops, func(i, j int) bool { return ops[i].ID > ops[j].ID })
+	return ops, nil
+}
+
+// Find retrieves an operation within a directory by its ID.
+func (history History) Find(directory string, id string) (Operation, error) {
+	ops, err := history.Operations(directory)
+	if err != nil {
+		return Operation{}, err
+	}
+
+	for _, v := range ops {
+		if v.ID == id {
+			return v, nil
+		}
+	}
+
+	return Operation{}, fmt.Errorf("no operation %q in the history of %v", id, directory)
+}
+
+// Remove deletes an operation from the history, once it has been undone or turned out to rename nothing.
+func (history History) Remove(op Operation) error {
+	if err := fs.Remove(history.JournalPath(op)); err != nil {
+		if exists, _ := fsutil.Exists(history.JournalPath(op)); exists {
+			return fmt.Errorf("error removing journal %v", err)
+		}
+	}
+	if err := fs.Remove(filepath.Join(history.Dir, op.ID+".json")); err != nil {
+		return fmt.Errorf("error removing history %v", err)
+	}
+
+	return nil
+}
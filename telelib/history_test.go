@@ -0,0 +1,112 @@
+package telelib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestHistory(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	history := History{Dir: "history"}
+
+	if ops, err := history.Operations("/shows"); err != nil || len(ops) != 0 {
+		t.Errorf("Operations() on an empty history = %+v, %v, want nothing", ops, err)
+	}
+
+	first, err := history.Start("/shows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := history.Start("/films")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := history.Start("/shows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	afero.WriteFile(fs, history.JournalPath(second), []byte{}, 0644)
+
+	ops, err := history.Operations("/shows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 2 || ops[0].ID != second.ID || ops[1].ID != first.ID {
+		t.Errorf("Operations() = %+v, want %v then %v", ops, second.ID, first.ID)
+	}
+
+	// Operations on files elsewhere are listed for the folders of those files too.
+	elsewhere, err := history.Start("/home", "/shows/Show")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op, err := history.Find("/shows/Show", elsewhere.ID); err != nil || op.ID != elsewhere.ID {
+		t.Errorf("Find() = %+v, %v, want %v", op, err, elsewhere.ID)
+	}
+	if err := history.Remove(elsewhere); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := history.Find("/shows", other.ID); err == nil {
+		t.Errorf("Find() found %v, which belongs to another directory", other.ID)
+	}
+	if op, err := history.Find("/films", other.ID); err != nil || op.ID != other.ID {
+		t.Errorf("Find() = %+v, %v, want %v", op, err, other.ID)
+	}
+
+	if err := history.Remove(second); err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Remove(first); err != nil {
+		t.Errorf("Remove() without a journal returned %v", err)
+	}
+
+	ops, err = history.Operations("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 1 || ops[0].ID != other.ID {
+		t.Errorf("Operations() after removing = %+v, want only %v", ops, other.ID)
+	}
+}
+
+func TestHistoryImport(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	history := History{Dir: "history"}
+	afero.WriteFile(fs, "A.mkv", []byte("random contents"), 0644)
+
+	newer, err := history.Start("/shows")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renames := []FileRename{{OldFileName: "a.mkv", NewFileName: "A.mkv"}}
+	op, err := history.Import("", renames, newer.Time.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Operations without a directory could have been performed anywhere, so are listed everywhere.
+	ops, err := history.Operations("/shows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The imported operation was performed before the newer one, so isn't undone first.
+	if len(ops) != 2 || ops[0].ID != newer.ID || ops[1].ID != op.ID {
+		t.Errorf("Operations() = %+v, want %v then %v", ops, newer.ID, op.ID)
+	}
+
+	completed, _, err := RecoverJournal(history.JournalPath(op))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(completed) != 1 || completed[0].FileRename != renames[0] {
+		t.Errorf("RecoverJournal() of an imported operation = %+v, want %+v", completed, renames)
+	}
+}
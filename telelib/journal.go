@@ -0,0 +1,280 @@
+package telelib
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// Journal states, recorded against each rename.
+const (
+	// JournalIntent is written before a rename is attempted.
+	JournalIntent = "intent"
+	// JournalDone is written once a rename has succeeded.
+	JournalDone = "done"
+	// JournalUndone is written once a rename has been reversed.
+	JournalUndone = "undone"
+)
+
+// JournalRecord is a single line within a journal file.
+type JournalRecord struct {
+	FileRename
+	State string `json:"state"`
+	// File is the state of the renamed file once a rename is done, so that undoing it can check nothing has
+	// changed since.
+	File *FileState `json:"file,omitempty"`
+}
+
+// Journal records every rename performed while applying a plan, so that they can be rolled back.
+// Journals opened with OpenJournal are also written to disk ahead of every rename, so that a run which is
+// interrupted part way through can still be undone.
+type Journal struct {
+	Completed []FileRename
+	file      afero.File
+	// renamed is the state of every completed rename's file, as it was renamed.
+	renamed map[FileRename]*FileState
+}
+
+// OpenJournal creates a journal file at path, replacing any journal already there.
+func OpenJournal(path string) (*Journal, error) {
+	file, err := fs.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error creating journal %v", err)
+	}
+
+	return &Journal{file: file}, nil
+}
+
+// ResumeJournal opens an existing journal file to be added to, such as to roll back the completed renames
+// returned by RecoverJournal.
+func ResumeJournal(path string, completed []JournalRecord) (*Journal, error) {
+	file, err := fs.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening journal %v", err)
+	}
+
+	journal := &Journal{file: file}
+	for _, v := range completed {
+		journal.add(v.FileRename, v.File)
+	}
+	return journal, nil
+}
+
+// write appends a record to the journal file, and waits for it to reach the disk.
+func (journal *Journal) write(file FileRename, state string) error {
+	if journal.file == nil {
+		return nil
+	}
+
+	record, err := json.Marshal(JournalRecord{FileRename: file, State: state, File: journal.renamed[file]})
+	if err != nil {
+		return fmt.Errorf("error converting journal record to JSON %v", err)
+	}
+
+	if _, err := journal.file.Write(append(record, '\n')); err != nil {
+		return fmt.Errorf("error writing journal %v", err)
+	}
+	if err := journal.file.Sync(); err != nil {
+		return fmt.Errorf("error syncing journal %v", err)
+	}
+
+	return nil
+}
+
+// Begin records that a rename is about to happen. Must succeed before the rename is attempted, otherwise
+// a crash could leave a rename nobody knows about.
+func (journal *Journal) Begin(file FileRename) error {
+	return journal.write(file, JournalIntent)
+}
+
+// Record adds a completed rename to the journal, along with the state of the renamed file.
+func (journal *Journal) Record(file FileRename) error {
+	journal.add(file, statFile(file.NewFileName))
+	return journal.write(file, JournalDone)
+}
+
+// add adds a completed rename, without writing it to the journal file.
+func (journal *Journal) add(file FileRename, state *FileState) {
+	if journal.renamed == nil {
+		journal.renamed = make(map[FileRename]*FileState)
+	}
+	journal.Completed = append(journal.Completed, file)
+	journal.renamed[file] = state
+}
+
+// Close closes the journal file, if there is one.
+func (journal *Journal) Close() error {
+	if journal.file == nil {
+		return nil
+	}
+	return journal.file.Close()
+}
+
+// Rollback reverses every completed rename, newest first, so that renames depending on earlier ones (e.g. a file
+// moved out of the way) are undone in the right order. Returns an error for every rename that couldn't be reversed.
+// Renames are only reversed if the renamed file is still there, unchanged, and nothing has taken its old name since,
+// so a rollback never overwrites or moves the wrong file. Copies and links are only removed while the original
+// is still there, so a rollback never removes the last copy of a file.
+// Renames that couldn't be reversed are left in Completed, in order, as they still need undoing.
+func (journal *Journal) Rollback() []error {
+	var errs []error
+	var remaining []FileRename
+
+	for i := len(journal.Completed) - 1; i >= 0; i-- {
+		file := journal.Completed[i]
+		if err := journal.verifyRollback(file); err != nil {
+			errs = append(errs, fmt.Errorf("unable to roll back %v to %v: %v", file.NewFileName, file.OldFileName, err))
+			remaining = append([]FileRename{file}, remaining...)
+			continue
+		}
+
+		if err := file.Revert(); err != nil {
+			errs = append(errs, fmt.Errorf("unable to roll back %v to %v: %v", file.NewFileName, file.OldFileName, err))
+			remaining = append([]FileRename{file}, remaining...)
+		} else if err := journal.write(file, JournalUndone); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for file := range journal.renamed {
+		if !containsRename(remaining, file) {
+			delete(journal.renamed, file)
+		}
+	}
+	journal.Completed = remaining
+	return errs
+}
+
+// containsRename reports whether a rename is in a list.
+func containsRename(files []FileRename, file FileRename) bool {
+	for _, v := range files {
+		if v == file {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyRollback checks a completed rename can be safely reversed.
+func (journal *Journal) verifyRollback(file FileRename) error {
+	current := statFile(file.NewFileName)
+	if current == nil {
+		return fmt.Errorf("%v no longer exists", file.NewFileName)
+	}
+	if recorded := journal.renamed[file]; recorded != nil && (current.Size != recorded.Size || !current.ModTime.Equal(recorded.ModTime)) {
+		return fmt.Errorf("%v has changed since it was renamed", file.NewFileName)
+	}
+	exists := file.exists(file.OldFileName)
+	if file.Action.Moves() && exists {
+		return fmt.Errorf("%v already exists", file.OldFileName)
+	}
+	if !file.Action.Moves() && !exists {
+		return fmt.Errorf("%v no longer exists, so %v is the only copy", file.OldFileName, file.NewFileName)
+	}
+
+	return nil
+}
+
+// ReadJournal reads every record from a journal file, in the order they were written.
+// A crash can leave the last line half written, so a line that can't be read ends the journal rather than failing.
+func ReadJournal(path string) ([]JournalRecord, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening journal %v", err)
+	}
+	defer file.Close()
+
+	var records []JournalRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record JournalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			break
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading journal %v", err)
+	}
+
+	return records, nil
+}
+
+// ReconcileJournal works out which renames in a journal were actually performed. Renames that were started but
+// never marked as done are checked against the disk: if only the new file exists, the rename happened. If both or
+// neither exist, there is no way to tell, so they are returned as unresolved. Copies and links only get their new
+// name once they are complete, so exist or don't, but a reflink that exists may not have finished, so is unresolved.
+// Completed renames are returned as their latest record, along with the state of the file when it was renamed.
+func ReconcileJournal(records []JournalRecord) (completed []JournalRecord, unresolved []FileRename) {
+	latest := make(map[FileRename]JournalRecord)
+	var order []FileRename
+	for _, v := range records {
+		if _, ok := latest[v.FileRename]; !ok {
+			order = append(order, v.FileRename)
+		}
+		latest[v.FileRename] = v
+	}
+
+	for _, v := range order {
+		record := latest[v]
+		switch record.State {
+		case JournalDone:
+			completed = append(completed, record)
+		case JournalIntent:
+			oldExists := v.exists(v.OldFileName)
+			newExists := v.exists(v.NewFileName)
+			switch {
+			case !newExists && !v.Action.Moves():
+				// Nothing was copied or linked.
+			case v.Action == ActionCopy || v.Action == ActionHardlink || v.Action == ActionSymlink, newExists && !oldExists && v.Action.Moves():
+				completed = append(completed, JournalRecord{FileRename: v, State: JournalDone})
+			case v.Action == ActionReflink, oldExists == newExists:
+				unresolved = append(unresolved, v)
+			}
+		}
+	}
+
+	return completed, unresolved
+}
+
+// RecoverJournal reconciles a journal left behind by an interrupted run, and rewrites it to only contain the
+// renames that were performed, so that they can be undone. Unresolved renames are kept in the journal as intents.
+func RecoverJournal(path string) (completed []JournalRecord, unresolved []FileRename, err error) {
+	records, err := ReadJournal(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	completed, unresolved = ReconcileJournal(records)
+
+	// The new journal is written alongside the old one, so a crash while recovering doesn't lose both.
+	journal, err := OpenJournal(path + ".tmp")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, v := range completed {
+		// The state of the file when it was renamed is kept, rather than recorded again.
+		journal.add(v.FileRename, v.File)
+		if err = journal.write(v.FileRename, JournalDone); err != nil {
+			break
+		}
+	}
+	for _, v := range unresolved {
+		if err == nil {
+			err = journal.Begin(v)
+		}
+	}
+	journal.Close()
+
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := fs.Rename(path+".tmp", path); err != nil {
+		return nil, nil, fmt.Errorf("error replacing journal %v", err)
+	}
+
+	return completed, unresolved, nil
+}
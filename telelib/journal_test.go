@@ -0,0 +1,252 @@
+package telelib
+
+import (
+	"log"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+)
+
+func TestJournalRollback(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	afero.WriteFile(fs, "a.mkv", []byte("random contents"), 0644)
+	afero.WriteFile(fs, "b.mkv", []byte("random contents"), 0644)
+
+	// b.mkv is moved out of the way so that a.mkv can take its name, so has to be rolled back last.
+	renames := []FileRename{
+		{OldFileName: "b.mkv", NewFileName: "c.mkv"},
+		{OldFileName: "a.mkv", NewFileName: "b.mkv"},
+	}
+
+	var journal Journal
+	for _, v := range renames {
+		if err := v.RenameFile(); err != nil {
+			t.Fatal(err)
+		}
+		journal.Record(v)
+	}
+
+	if errs := journal.Rollback(); len(errs) != 0 {
+		t.Errorf("Journal.Rollback() returned errors %v", errs)
+	}
+
+	for _, v := range []string{"a.mkv", "b.mkv"} {
+		exists, err := afero.Exists(fs, v)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !exists {
+			t.Errorf("Journal.Rollback() - %q was not found", v)
+		}
+	}
+	if exists, _ := afero.Exists(fs, "c.mkv"); exists {
+		t.Errorf("Journal.Rollback() - %q was not rolled back", "c.mkv")
+	}
+	if len(journal.Completed) != 0 {
+		t.Errorf("Journal.Rollback() left %+v in the journal", journal.Completed)
+	}
+}
+
+func TestApplyAtomic(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	afero.WriteFile(fs, "a.mkv", []byte("random contents"), 0644)
+	afero.WriteFile(fs, "b.mkv", []byte("random contents"), 0644)
+
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: "a.mkv", NewFileName: "A.mkv"}},
+		{FileRename: FileRename{OldFileName: "b.mkv", NewFileName: "B.mkv"}},
+		{FileRename: FileRename{OldFileName: "missing.mkv", NewFileName: "Missing.mkv"}},
+	}}
+
+	renamed, errs := plan.ApplyWithOptions(ApplyOptions{Atomic: true})
+	if len(renamed) != 0 {
+		t.Errorf("ApplyWithOptions() returned renames %+v, expected none", renamed)
+	}
+	if len(errs) != 1 {
+		t.Errorf("ApplyWithOptions() returned errors %v, expected one for missing.mkv", errs)
+	}
+
+	for _, v := range []string{"a.mkv", "b.mkv"} {
+		if exists, _ := afero.Exists(fs, v); !exists {
+			t.Errorf("ApplyWithOptions() - %q was not rolled back", v)
+		}
+	}
+}
+
+func TestApplyAtomicPartialRollback(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	afero.WriteFile(fs, "a.mkv", []byte("random contents"), 0644)
+	afero.WriteFile(fs, "b.mkv", []byte("random contents"), 0644)
+
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: "a.mkv", NewFileName: "A.mkv"}},
+		{FileRename: FileRename{OldFileName: "b.mkv", NewFileName: "B.mkv", Action: ActionCopy}},
+		{FileRename: FileRename{OldFileName: "missing.mkv", NewFileName: "Missing.mkv"}},
+	}}
+
+	// A.mkv changes while b.mkv is being copied, so can't be rolled back.
+	progress := func(file FileRename, copied int64, total int64) {
+		afero.WriteFile(fs, "A.mkv", []byte("changed contents"), 0644)
+	}
+
+	renamed, errs := plan.ApplyWithOptions(ApplyOptions{Atomic: true, Progress: progress})
+	if want := []FileRename{{OldFileName: "a.mkv", NewFileName: "A.mkv"}}; !cmp.Equal(renamed, want) {
+		t.Errorf("ApplyWithOptions() returned renames %+v, expected %+v, which couldn't be rolled back", renamed, want)
+	}
+	if len(errs) != 2 {
+		t.Errorf("ApplyWithOptions() returned errors %v, expected one for missing.mkv and one for A.mkv", errs)
+	}
+	if exists, _ := afero.Exists(fs, "B.mkv"); exists {
+		t.Errorf("ApplyWithOptions() - %q was not rolled back", "B.mkv")
+	}
+}
+
+func TestApplyJournal(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	afero.WriteFile(fs, "a.mkv", []byte("random contents"), 0644)
+
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: "a.mkv", NewFileName: "A.mkv"}},
+		{FileRename: FileRename{OldFileName: "missing.mkv", NewFileName: "Missing.mkv"}},
+	}}
+
+	plan.ApplyWithOptions(ApplyOptions{JournalPath: "journal.jsonl"})
+
+	records, err := ReadJournal("journal.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []JournalRecord{
+		{FileRename: FileRename{OldFileName: "a.mkv", NewFileName: "A.mkv"}, State: JournalIntent},
+		{FileRename: FileRename{OldFileName: "a.mkv", NewFileName: "A.mkv"}, State: JournalDone},
+		{FileRename: FileRename{OldFileName: "missing.mkv", NewFileName: "Missing.mkv"}, State: JournalIntent},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("ReadJournal() = %+v, want %+v", records, want)
+	}
+	for i := range want {
+		if records[i].FileRename != want[i].FileRename || records[i].State != want[i].State {
+			t.Errorf("ReadJournal()[%v] = %+v, want %+v", i, records[i], want[i])
+		}
+	}
+}
+
+func TestReadJournalTruncated(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	// A crash part way through writing a record leaves half a line behind.
+	afero.WriteFile(fs, "journal.jsonl", []byte(`{"OldFileName":"a.mkv","NewFileName":"A.mkv","state":"done"}
+{"OldFileName":"b.mkv","NewFi`), 0644)
+
+	records, err := ReadJournal("journal.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].OldFileName != "a.mkv" {
+		t.Errorf("ReadJournal() = %+v, want only the a.mkv record", records)
+	}
+}
+
+func TestRecoverJournal(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	// done.mkv was renamed and journalled, renamed.mkv was renamed but the run died before it was journalled,
+	// untouched.mkv was never renamed, both.mkv and its new name exist, and undone.mkv was already rolled back.
+	afero.WriteFile(fs, "Done.mkv", []byte("random contents"), 0644)
+	afero.WriteFile(fs, "Renamed.mkv", []byte("random contents"), 0644)
+	afero.WriteFile(fs, "untouched.mkv", []byte("random contents"), 0644)
+	afero.WriteFile(fs, "both.mkv", []byte("random contents"), 0644)
+	afero.WriteFile(fs, "Both.mkv", []byte("random contents"), 0644)
+	afero.WriteFile(fs, "Undone.mkv", []byte("random contents"), 0644)
+
+	journal, err := OpenJournal("journal.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := FileRename{OldFileName: "done.mkv", NewFileName: "Done.mkv"}
+	renamed := FileRename{OldFileName: "renamed.mkv", NewFileName: "Renamed.mkv"}
+	untouched := FileRename{OldFileName: "untouched.mkv", NewFileName: "Untouched.mkv"}
+	both := FileRename{OldFileName: "both.mkv", NewFileName: "Both.mkv"}
+	undone := FileRename{OldFileName: "undone.mkv", NewFileName: "Undone.mkv"}
+	journal.Begin(undone)
+	journal.Record(undone)
+	journal.Rollback()
+	journal.Begin(done)
+	journal.Record(done)
+	journal.Begin(renamed)
+	journal.Begin(untouched)
+	journal.Begin(both)
+	journal.Close()
+
+	completed, unresolved, err := RecoverJournal("journal.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(completed) != 2 || completed[0].FileRename != done || completed[1].FileRename != renamed {
+		t.Errorf("RecoverJournal() completed = %+v, want %+v", completed, []FileRename{done, renamed})
+	}
+	if len(completed) == 2 && completed[0].File == nil {
+		t.Errorf("RecoverJournal() lost the state of %v when it was renamed", done.NewFileName)
+	}
+	if len(unresolved) != 1 || unresolved[0] != both {
+		t.Errorf("RecoverJournal() unresolved = %+v, want %+v", unresolved, []FileRename{both})
+	}
+
+	// Recovering again should find the same renames in the rewritten journal.
+	again, _, err := RecoverJournal("journal.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != len(completed) {
+		t.Errorf("RecoverJournal() on a recovered journal = %+v, want %+v", again, completed)
+	}
+}
+
+func TestRollbackConflicts(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	for _, v := range []string{"changed.mkv", "taken.mkv", "missing.mkv", "fine.mkv"} {
+		afero.WriteFile(fs, v, []byte("random contents"), 0644)
+	}
+
+	var journal Journal
+	for _, v := range []string{"changed.mkv", "taken.mkv", "missing.mkv", "fine.mkv"} {
+		rename := FileRename{OldFileName: v, NewFileName: "renamed " + v}
+		if err := rename.RenameFile(); err != nil {
+			t.Fatal(err)
+		}
+		journal.Record(rename)
+	}
+
+	afero.WriteFile(fs, "renamed changed.mkv", []byte("different, longer contents"), 0644)
+	afero.WriteFile(fs, "taken.mkv", []byte("another file"), 0644)
+	fs.Remove("renamed missing.mkv")
+
+	if errs := journal.Rollback(); len(errs) != 3 {
+		t.Errorf("Journal.Rollback() returned errors %v, expected one each for changed, taken and missing", errs)
+	}
+
+	// Only the unchanged file is renamed back, and nothing is overwritten.
+	for _, v := range []string{"renamed changed.mkv", "renamed taken.mkv", "fine.mkv"} {
+		if exists, _ := afero.Exists(fs, v); !exists {
+			t.Errorf("Journal.Rollback() - %q was not found", v)
+		}
+	}
+	if contents, _ := afero.ReadFile(fs, "taken.mkv"); string(contents) != "another file" {
+		t.Errorf("Journal.Rollback() overwrote taken.mkv")
+	}
+}
@@ -1,7 +1,9 @@
 package telelib
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -22,9 +24,15 @@ type RawFileInfo struct {
 	Container string
 	Season    int
 	Episode   int
-	Series    string
-	invalid   bool
-	err       error
+	// LastEpisode is the final episode in a multi-episode file (e.g. S01E01-E02), and 0 otherwise.
+	LastEpisode int
+	Series      string
+	// Language is the language code of a subtitle file (e.g. "en"), if its name has one.
+	Language string
+	// SubFlags are the flags of a subtitle file (e.g. "sdh" or "forced"), joined with ".".
+	SubFlags string
+	invalid  bool
+	err      error
 }
 
 // ParsedFileInfo is the info about the file retrieved from an API provider.
@@ -33,8 +41,11 @@ type ParsedFileInfo struct {
 	Container   string
 	Season      int
 	Episode     int
+	LastEpisode int
 	EpisodeName string
 	Series      string
+	Language    string
+	SubFlags    string
 }
 
 // FileRename keeps both the old filename and the new filename.
@@ -42,6 +53,8 @@ type ParsedFileInfo struct {
 type FileRename struct {
 	OldFileName string `json:"oldfilename"`
 	NewFileName string `json:"newfilename"`
+	// Action is how the file ends up at its new name. Defaults to ActionRename.
+	Action Action `json:"action,omitempty"`
 }
 
 // TVDBLogin replicates https://github.com/pioz/tvdb/blob/master/client.go's Client struct, with some additional JSON support.
@@ -67,42 +80,80 @@ func init() {
 }
 
 func parseFile(fileName string, series string, files chan RawFileInfo) {
+	parseFileWithOptions(fileName, ParseOptions{Series: series}, files)
+}
+
+func parseFileWithOptions(fileName string, opts ParseOptions, files chan RawFileInfo) {
+	series := opts.Series
+
+	// Only the name of the file says anything about the episode, the folders it is in may not.
+	baseName := filepath.Base(fileName)
+
 	// ptn sometimes fails with well defined file names, that have seperators - this aims to find such
 	// seperators and strip them from the filename and title..
 	// e.g. "Test - EG", the Title would be "Test - ", instead of "Test".
 	dividerRe, _ := regexp.Compile(` ?(-|\||:|\[|\]) ?`)
 
-	cleanFileName := dividerRe.ReplaceAllString(fileName, " ")
+	cleanFileName := dividerRe.ReplaceAllString(baseName, " ")
 
 	parsed, err := parsetorrentname.Parse(cleanFileName)
 	if err != nil {
 		// Don't control this, so could potentially fail.
 		// Might be that a file does not have enough information to pull from this.
 		files <- RawFileInfo{invalid: true, err: fmt.Errorf("parsetorrentname.Parse(%v): %v", cleanFileName, err)}
+		return
 	}
 
 	// Checks if file is a subtitle. Not included in base parser.
-	subtitleRe, _ := regexp.Compile(`(\.srt|\.txt|\.vtt\.scc\.stl)`)
-
-	subtitle := subtitleRe.FindString(fileName)
+	subtitle := subtitleRe.FindString(baseName)
 
 	if series == "" {
 		series = dividerRe.ReplaceAllString(parsed.Title, " ")
 	}
 
+	lastEpisode := parseLastEpisode(baseName, parsed.Episode)
+
+	// Allowed extensions are videos, whether or not ptn knows them as such.
+	if ext := extension(baseName); parsed.Container == "" && subtitle == "" && contains(opts.Filter.Allow, ext) {
+		parsed.Container = ext
+	}
+
 	// Remove anything that isn't a video file.
 	if parsed.Container != "" {
-		files <- RawFileInfo{FileName: fileName, Container: parsed.Container, Season: parsed.Season, Episode: parsed.Episode, Series: series}
+		files <- RawFileInfo{FileName: fileName, Container: parsed.Container, Season: parsed.Season, Episode: parsed.Episode, LastEpisode: lastEpisode, Series: series}
 	} else if subtitle != "" {
 		// Note: while Golang does interpret strings as UTF8, and thus, if we were dealing with unknown strings, subtitle[1:]
 		// would be error prone, we both know the string exists, and starts with ".", therefore, there is no risk.
-		files <- RawFileInfo{FileName: fileName, Container: subtitle[1:], Season: parsed.Season, Episode: parsed.Episode, Series: series}
+		language, subFlags := parseSubtitleTags(baseName)
+		files <- RawFileInfo{FileName: fileName, Container: subtitle[1:], Season: parsed.Season, Episode: parsed.Episode, LastEpisode: lastEpisode, Series: series, Language: language, SubFlags: subFlags}
 	} else {
 		// Can't just silently discard due to the new concurrency model.
 		files <- RawFileInfo{invalid: true}
 	}
 }
 
+// parseLastEpisode finds the final episode of a multi-episode file name, such as S01E01-E02, S01E01E02 or 1x01-02.
+// ptn only reports the first episode, so we look for the rest ourselves. Returns 0 for single episode files.
+// Every episode after the first needs its own "E" in the S01E01 form, and episodes have to be followed by a
+// separator, so "S01E01-720p" and "1x05-10bit" are single episodes.
+func parseLastEpisode(fileName string, episode int) int {
+	multiEpisodeRe, _ := regexp.Compile(`(?i)(?:s\d+e\d+((?:-?e\d+)+)|\d+x\d+((?:-\d+)+))(?:[.\s_\-\]]|$)`)
+	numberRe, _ := regexp.Compile(`\d+`)
+
+	match := multiEpisodeRe.FindStringSubmatch(fileName)
+	if match == nil {
+		return 0
+	}
+
+	numbers := numberRe.FindAllString(match[1]+match[2], -1)
+	last, err := strconv.Atoi(numbers[len(numbers)-1])
+	if err != nil || last <= episode {
+		return 0
+	}
+
+	return last
+}
+
 // parseFiles parses a file list from GetFiles() and a series parameter.
 // If series is "", it will attempt to retrieve this from the file name.
 // Public functions are ParseFiles() and ParseFilesWithSeries()
@@ -128,23 +179,48 @@ func parseFiles(fileList []string, series string) []RawFileInfo {
 // parseFiles, but slightly worse, for UX/backwards compatability.
 // The difference in execution is neglible.
 func parseFilesInOrder(fileList []string, series string) []RawFileInfo {
+	temp, _ := ParseFilesWithOptions(fileList, ParseOptions{Series: series})
+	return temp
+}
+
+// ParseOptions changes how ParseFilesWithOptions parses files.
+type ParseOptions struct {
+	// Series is the name of the series, if it isn't included within the file names.
+	Series string
+	// Filter decides which files are parsed.
+	Filter FileFilter
+}
+
+// ParseFilesWithOptions parses a file list from GetFiles(), in order, as described by the options. Also returns
+// every file that was skipped, and why, rather than silently dropping them.
+func ParseFilesWithOptions(fileList []string, opts ParseOptions) ([]RawFileInfo, []SkippedFile) {
 	var temp []RawFileInfo
+	var skipped []SkippedFile
 	var fileChans []chan RawFileInfo
 
 	for _, fileName := range fileList {
-		files := make(chan RawFileInfo)
+		files := make(chan RawFileInfo, 1)
 		fileChans = append(fileChans, files)
-		go parseFile(fileName, series, files)
+		if reason := opts.Filter.Skips(fileName); reason != "" {
+			files <- RawFileInfo{FileName: fileName, invalid: true, err: errors.New(reason)}
+			continue
+		}
+		go parseFileWithOptions(fileName, opts, files)
 	}
 
-	for _, v := range fileChans {
+	for i, v := range fileChans {
 		result := <-v
-		if !result.invalid {
+		switch {
+		case !result.invalid:
 			temp = append(temp, result)
+		case result.err != nil:
+			skipped = append(skipped, SkippedFile{FileName: fileList[i], Reason: result.err.Error()})
+		default:
+			skipped = append(skipped, SkippedFile{FileName: fileList[i], Reason: "not a video or subtitle"})
 		}
 	}
 
-	return temp
+	return temp, skipped
 }
 
 // ParseFilesWithSeries parses a file list from GetFiles() where the title is not included within the file name.
@@ -158,9 +234,9 @@ func ParseFiles(fileList []string) []RawFileInfo {
 	return parseFilesInOrder(fileList, "")
 }
 
-// GetFiles retrieves a list of files from the current directory.
+// GetFiles retrieves a list of files from a directory, as paths joined onto the directory.
 func GetFiles(directory string) ([]string, error) {
-	files, err := afero.ReadDir(fs, ".")
+	files, err := afero.ReadDir(fs, directory)
 	if err != nil {
 		return nil, fmt.Errorf("error reading dir in getfiles %v", err)
 	}
@@ -168,7 +244,7 @@ func GetFiles(directory string) ([]string, error) {
 
 	for _, file := range files {
 		if !file.IsDir() {
-			fileList = append(fileList, file.Name())
+			fileList = append(fileList, filepath.Join(directory, file.Name()))
 		}
 	}
 
@@ -191,7 +267,7 @@ func RenameFiles(renameList []FileRename) {
 // RetrieveEpisodeInfo retrieves the information for a episode.
 func (fileInfo RawFileInfo) RetrieveEpisodeInfo(login TVDBLogin) (ParsedFileInfo, error) {
 	c := tvdb.Client{Apikey: login.Apikey, Userkey: login.Userkey, Username: login.Username, Language: login.Language}
-	newFileInfo := ParsedFileInfo{FileName: fileInfo.FileName, Season: fileInfo.Season, Container: fileInfo.Container}
+	newFileInfo := ParsedFileInfo{FileName: fileInfo.FileName, Season: fileInfo.Season, LastEpisode: fileInfo.LastEpisode, Container: fileInfo.Container, Language: fileInfo.Language, SubFlags: fileInfo.SubFlags}
 
 	err := c.Login()
 	if err != nil {
@@ -218,29 +294,141 @@ func (fileInfo RawFileInfo) RetrieveEpisodeInfo(login TVDBLogin) (ParsedFileInfo
 	newFileInfo.EpisodeName = episode.EpisodeName
 	newFileInfo.Episode = episode.AiredEpisodeNumber
 
+	// Multi-episode files are named after every episode within them.
+	for i := fileInfo.Episode + 1; i <= fileInfo.LastEpisode; i++ {
+		if next := series.GetEpisode(fileInfo.Season, i); next != nil && next.EpisodeName != "" {
+			newFileInfo.EpisodeName += " & " + next.EpisodeName
+		}
+	}
+
 	return newFileInfo, nil
 }
 
-// NewFileName returns a file name.
+// defaultMultiEpisode is what {m} becomes in a multi-episode file, unless a preset says otherwise.
+const defaultMultiEpisode = "-E{0le}"
+
+// NewFileName returns a file name, in the same folder as the original file.
+// Folders can be included in the format with "/", e.g. "{s}/Season {0z}/{s} - S{0z}E{0e} - {n}".
 func (p ParsedFileInfo) NewFileName(customFormat string) FileRename {
+	return p.NewFileNameWithOptions(customFormat, NamingOptions{})
+}
+
+// NewFileNameWithOptions returns a file name, sanitized and cleaned up as described by the options.
+func (p ParsedFileInfo) NewFileNameWithOptions(customFormat string, opts NamingOptions) FileRename {
+	if p.LastEpisode > p.Episode {
+		customFormat = strings.ReplaceAll(customFormat, "{m}", defaultMultiEpisode)
+	} else {
+		customFormat = strings.ReplaceAll(customFormat, "{m}", "")
+	}
+
+	// Subtitles keep their language and flags, even if the format doesn't say where they go.
+	if isSubtitle(p.Container) && !strings.Contains(customFormat, "{lang}") && !strings.Contains(customFormat, "{subflags}") {
+		if p.Language != "" {
+			customFormat += ".{lang}"
+		}
+		if p.SubFlags != "" {
+			customFormat += ".{subflags}"
+		}
+	}
+
+	p.Series = opts.replace(opts.normalize(p.Series))
+	p.EpisodeName = opts.replace(opts.normalize(p.EpisodeName))
+
+	// Each folder is filled in separately, so that a "/" within a series or episode name can't create a new folder.
+	segments := strings.Split(customFormat, "/")
+	for i, segment := range segments {
+		extension := 0
+		if i == len(segments)-1 {
+			extension = len(p.Container) + 1
+		}
+		segments[i] = p.fitSegment(segment, extension, opts)
+	}
+
+	dir := filepath.Dir(p.FileName)
+	if opts.DestDir != "" {
+		dir = opts.DestDir
+	} else if len(segments) > 1 && opts.BaseDir != "" {
+		dir = opts.BaseDir
+	}
+	segments = append([]string{dir}, segments...)
+	return FileRename{OldFileName: p.FileName, NewFileName: opts.trimEnd(fmt.Sprintf("%s.%s", filepath.Join(segments...), p.Container))}
+}
+
+// fitSegment fills in a single folder or file name of a format, keeping it within the maximum length.
+// Episode names are the least important part of a file name, so they get shortened first, and the rest
+// of the name is only cut if the name is still too long without it.
+func (p ParsedFileInfo) fitSegment(customFormat string, extension int, opts NamingOptions) string {
+	limit := opts.maxLength() - extension
+	folder := extension == 0
+	name := opts.sanitize(p.formatSegment(customFormat), folder)
+
+	for over := len(name) - limit; over > 0 && p.EpisodeName != ""; over = len(name) - limit {
+		p.EpisodeName = strings.TrimRight(truncate(p.EpisodeName, len(p.EpisodeName)-over), " ")
+		name = opts.sanitize(p.formatSegment(customFormat), folder)
+	}
+
+	if len(name) > limit {
+		name = opts.sanitize(truncate(name, limit), folder)
+	}
+
+	return name
+}
+
+// formatSegment fills in a single folder or file name of a format.
+func (p ParsedFileInfo) formatSegment(customFormat string) string {
+	lastEpisode := p.LastEpisode
+	if lastEpisode < p.Episode {
+		lastEpisode = p.Episode
+	}
+
 	// Due to optional format strings {0e} and {0z}, I'm going to keep this simple text replacement vs a smarter templating
 	// system for now...
 	customFormat = strings.ReplaceAll(customFormat, "{s}", p.Series)
 	customFormat = strings.ReplaceAll(customFormat, "{n}", p.EpisodeName)
 	customFormat = strings.ReplaceAll(customFormat, "{e}", strconv.Itoa(p.Episode))
 	customFormat = strings.ReplaceAll(customFormat, "{0e}", fmt.Sprintf("%02d", p.Episode))
+	customFormat = strings.ReplaceAll(customFormat, "{le}", strconv.Itoa(lastEpisode))
+	customFormat = strings.ReplaceAll(customFormat, "{0le}", fmt.Sprintf("%02d", lastEpisode))
 	customFormat = strings.ReplaceAll(customFormat, "{z}", strconv.Itoa(p.Season))
 	customFormat = strings.ReplaceAll(customFormat, "{0z}", fmt.Sprintf("%02d", p.Season))
+	customFormat = strings.ReplaceAll(customFormat, "{lang}", p.Language)
+	customFormat = strings.ReplaceAll(customFormat, "{subflags}", p.SubFlags)
 
-	// Removes characters that aren't accepted in Windows file names.
-	winInvalidName, _ := regexp.Compile(`(\?|\\|\/|\*|\:|"|<|>|\|)`)
-	customFormat = winInvalidName.ReplaceAllString(customFormat, "")
-
-	return FileRename{OldFileName: p.FileName, NewFileName: fmt.Sprintf("%s.%s", customFormat, p.Container)}
+	return customFormat
 }
 
-// RenameFile renames the file based on the contents of the struct.
+// RenameFile renames the file based on the contents of the struct, or copies or links it, depending on the action.
 func (file FileRename) RenameFile() error {
+	return file.RenameFileWithProgress(nil)
+}
+
+// RenameFileWithProgress renames the file as RenameFile does, reporting the progress of any copying.
+func (file FileRename) RenameFileWithProgress(progress Progress) error {
+	// Formats with folders need them to exist before anything can be moved into them.
+	if dir := filepath.Dir(file.NewFileName); dir != "." {
+		if err := fs.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("error creating folder %v", err)
+		}
+	}
+
+	// Case-only renames go through a temporary name, as case-insensitive filesystems see both names as the same file.
+	if file.caseOnly() && file.Action.Moves() {
+		return renameCase(file.OldFileName, file.NewFileName)
+	}
+
+	switch file.Action {
+	case ActionMove:
+		return moveFile(file.OldFileName, file.NewFileName, progress)
+	case ActionCopy:
+		return copyFile(file.OldFileName, file.NewFileName, progress)
+	case ActionHardlink:
+		return hardlinkFile(file.OldFileName, file.NewFileName)
+	case ActionSymlink:
+		return symlinkFile(file.OldFileName, file.NewFileName)
+	case ActionReflink:
+		return reflinkFile(file.OldFileName, file.NewFileName)
+	}
+
 	err := fs.Rename(file.OldFileName, file.NewFileName)
 
 	if err != nil {
@@ -3,6 +3,7 @@ package telelib
 import (
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -60,6 +61,57 @@ func TestParseFile(t *testing.T) {
 			"",
 			RawFileInfo{FileName: "South Park - [01x03] - Volcano.srt", Container: "srt", Season: 1, Episode: 3, Series: "South Park"},
 		},
+		{
+			filepath.FromSlash("downloads/The.Good.Place.S4/The Good Place - S04E07 - Help Is Other People.mkv"),
+			"",
+			RawFileInfo{FileName: filepath.FromSlash("downloads/The.Good.Place.S4/The Good Place - S04E07 - Help Is Other People.mkv"), Container: "mkv", Season: 4, Episode: 7, Series: "The Good Place"},
+		},
+		{
+			"Show.S01E01.en.sdh.srt",
+			"",
+			RawFileInfo{FileName: "Show.S01E01.en.sdh.srt", Container: "srt", Season: 1, Episode: 1, Series: "Show", Language: "en", SubFlags: "sdh"},
+		},
+		{
+			"Show.S01E02.pt-BR.forced.vtt",
+			"",
+			RawFileInfo{FileName: "Show.S01E02.pt-BR.forced.vtt", Container: "vtt", Season: 1, Episode: 2, Series: "Show", Language: "pt-BR", SubFlags: "forced"},
+		},
+		// Language codes that are also words in episode names aren't languages.
+		{
+			"Show.S01E01.Let.It.srt",
+			"",
+			RawFileInfo{FileName: "Show.S01E01.Let.It.srt", Container: "srt", Season: 1, Episode: 1, Series: "Show"},
+		},
+		{
+			"Show.S01E01.Let.It.Be.Is.srt",
+			"",
+			RawFileInfo{FileName: "Show.S01E01.Let.It.Be.Is.srt", Container: "srt", Season: 1, Episode: 1, Series: "Show"},
+		},
+		{
+			"Show.S01E01.Yes.No.srt",
+			"",
+			RawFileInfo{FileName: "Show.S01E01.Yes.No.srt", Container: "srt", Season: 1, Episode: 1, Series: "Show"},
+		},
+		{
+			"Show.S01E01.it.srt",
+			"",
+			RawFileInfo{FileName: "Show.S01E01.it.srt", Container: "srt", Season: 1, Episode: 1, Series: "Show", Language: "it"},
+		},
+		{
+			"Show.S01E01.Say.Hi.srt",
+			"",
+			RawFileInfo{FileName: "Show.S01E01.Say.Hi.srt", Container: "srt", Season: 1, Episode: 1, Series: "Show"},
+		},
+		{
+			"Show.S01E03.stl",
+			"",
+			RawFileInfo{FileName: "Show.S01E03.stl", Container: "stl", Season: 1, Episode: 3, Series: "Show"},
+		},
+		{
+			"Show.S01E04.txt.nfo",
+			"",
+			RawFileInfo{invalid: true},
+		},
 		{
 			"Test.png",
 			"",
@@ -79,6 +131,33 @@ func TestParseFile(t *testing.T) {
 	}
 }
 
+func TestParseLastEpisode(t *testing.T) {
+	cases := []struct {
+		in      string
+		episode int
+		want    int
+	}{
+		{"The Good Place - S01E01-E02 - Everything Is Fine.mkv", 1, 2},
+		{"the.good.place.s01e01e02e03.1080p.mkv", 1, 3},
+		{"The Good Place - 01x01-02 - Everything Is Fine.mkv", 1, 2},
+		{"The Good Place - S04E07 - Help Is Other People.mkv", 7, 0},
+		{"The Good Place S04E07 720p.mkv", 7, 0},
+		{"The.Show.S01E01-720p.mkv", 1, 0},
+		{"The.Show.1x01-1080i.mkv", 1, 0},
+		{"The.Show.1x01-02-720p.mkv", 1, 2},
+		{"Show.1x05-10bit.mkv", 5, 0},
+		{"Show.S01E05E06x264.mkv", 5, 0},
+		{"Show - [1x05-06] - Title.mkv", 5, 6},
+	}
+
+	for _, c := range cases {
+		got := parseLastEpisode(c.in, c.episode)
+		if got != c.want {
+			t.Errorf("parseLastEpisode(%q, %v) == %v, want %v", c.in, c.episode, got, c.want)
+		}
+	}
+}
+
 func TestParseFiles(t *testing.T) {
 	fileList := []string{
 		"The Good Place - S04E07 - Help Is Other People.mkv",
@@ -168,6 +247,31 @@ func TestNewFileName(t *testing.T) {
 			"{s} - S{0z}E{0e} - {n}",
 			"The Good Place - S05E01 - Backstreet's Back.srt",
 		},
+		{
+			ParsedFileInfo{FileName: "", Container: "mkv", Series: "The Good Place", Season: 1, Episode: 1, LastEpisode: 2, EpisodeName: "Everything Is Fine"},
+			"{s} - S{0z}E{0e}{m} - {n}",
+			"The Good Place - S01E01-E02 - Everything Is Fine.mkv",
+		},
+		{
+			ParsedFileInfo{FileName: "", Container: "mkv", Series: "The Good Place", Season: 1, Episode: 1, EpisodeName: "Everything Is Fine"},
+			"{s}/Season {0z}/{s} - S{0z}E{0e}{m} - {n}",
+			filepath.FromSlash("The Good Place/Season 01/The Good Place - S01E01 - Everything Is Fine.mkv"),
+		},
+		{
+			ParsedFileInfo{FileName: filepath.FromSlash("/shows/the.good.place.s05e01.mkv"), Container: "mkv", Series: "The Good Place", Season: 5, Episode: 1, EpisodeName: "Backstreet's Back"},
+			"{s} - S{0z}E{0e} - {n}",
+			filepath.FromSlash("/shows/The Good Place - S05E01 - Backstreet's Back.mkv"),
+		},
+		{
+			ParsedFileInfo{FileName: "", Container: "srt", Series: "The Good Place", Season: 5, Episode: 1, EpisodeName: "Backstreet's Back", Language: "en", SubFlags: "sdh.forced"},
+			"{s} - S{0z}E{0e} - {n}",
+			"The Good Place - S05E01 - Backstreet's Back.en.sdh.forced.srt",
+		},
+		{
+			ParsedFileInfo{FileName: "", Container: "srt", Series: "The Good Place", Season: 5, Episode: 1, EpisodeName: "Backstreet's Back", Language: "en", SubFlags: "sdh"},
+			"{s} - S{0z}E{0e} [{lang}] - {n}",
+			"The Good Place - S05E01 [en] - Backstreet's Back.srt",
+		},
 	}
 
 	for _, v := range cases {
@@ -202,6 +306,19 @@ func TestGetFiles(t *testing.T) {
 	if !cmp.Equal(result, expected) {
 		t.Errorf("GetFiles(\".\") == %q, expected %q", result, expected)
 	}
+
+	// Files in other folders keep their folder, so that they can be renamed from anywhere.
+	afero.WriteFile(fs, filepath.Join("shows", "test4.mkv"), []byte("random contents"), 0644)
+
+	result, err = GetFiles("shows")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	expected = []string{filepath.Join("shows", "test4.mkv")}
+	if !cmp.Equal(result, expected) {
+		t.Errorf("GetFiles(\"shows\") == %q, expected %q", result, expected)
+	}
 }
 
 func TestRenameFile(t *testing.T) {
@@ -220,6 +337,10 @@ func TestRenameFile(t *testing.T) {
 			FileRename{OldFileName: "test2.mp4", NewFileName: "new2.mp4"},
 			"new2.mp4",
 		},
+		{
+			FileRename{OldFileName: "test3.mp4", NewFileName: filepath.FromSlash("Test/Season 01/new3.mp4")},
+			filepath.FromSlash("Test/Season 01/new3.mp4"),
+		},
 	}
 
 	for _, v := range cases {
@@ -0,0 +1,105 @@
+package telelib
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// crossDeviceFs acts as if everything within "other" is on another filesystem, which files can't be renamed onto.
+type crossDeviceFs struct {
+	afero.Fs
+	// failWrites makes every write to a new file fail, as if the disk was full.
+	failWrites bool
+}
+
+func (c crossDeviceFs) Rename(oldname string, newname string) error {
+	if strings.HasPrefix(oldname, "other") != strings.HasPrefix(newname, "other") {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EXDEV}
+	}
+	return c.Fs.Rename(oldname, newname)
+}
+
+func (c crossDeviceFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	file, err := c.Fs.OpenFile(name, flag, perm)
+	if err != nil || !c.failWrites || flag&os.O_CREATE == 0 {
+		return file, err
+	}
+	return failingFile{file}, nil
+}
+
+type failingFile struct {
+	afero.File
+}
+
+func (failingFile) Write(p []byte) (int, error) {
+	return 0, errors.New("no space left on device")
+}
+
+func TestMoveAcrossFilesystems(t *testing.T) {
+	fs = crossDeviceFs{Fs: afero.NewMemMapFs()}
+	fsutil = &afero.Afero{Fs: fs}
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	afero.WriteFile(fs, "a.mkv", []byte("random contents"), 0644)
+	fs.Chtimes("a.mkv", modTime, modTime)
+
+	// Renames stay on the same filesystem, so fail rather than copying.
+	if err := (FileRename{OldFileName: "a.mkv", NewFileName: "other/A.mkv"}).RenameFile(); err == nil {
+		t.Errorf("RenameFile() renamed onto another filesystem")
+	}
+
+	var copied, total int64
+	file := FileRename{OldFileName: "a.mkv", NewFileName: "other/A.mkv", Action: ActionMove}
+	err := file.RenameFileWithProgress(func(c int64, t int64) { copied, total = c, t })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, _ := afero.Exists(fs, "a.mkv"); exists {
+		t.Errorf("RenameFile() with %q didn't remove the original", ActionMove)
+	}
+	if contents, _ := afero.ReadFile(fs, "other/A.mkv"); string(contents) != "random contents" {
+		t.Errorf("RenameFile() with %q moved %q", ActionMove, contents)
+	}
+	if info, err := fs.Stat("other/A.mkv"); err != nil || !info.ModTime().Equal(modTime) {
+		t.Errorf("RenameFile() with %q didn't keep the modification time: %v", ActionMove, info)
+	}
+	if copied != total || total != int64(len("random contents")) {
+		t.Errorf("RenameFile() with %q reported progress %v of %v", ActionMove, copied, total)
+	}
+
+	// Undoing moves it back across.
+	if err := file.Revert(); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := afero.Exists(fs, "a.mkv"); !exists {
+		t.Errorf("Revert() with %q didn't move the file back", ActionMove)
+	}
+}
+
+func TestMoveAcrossFilesystemsFailure(t *testing.T) {
+	base := afero.NewMemMapFs()
+	afero.WriteFile(base, "a.mkv", []byte("random contents"), 0644)
+
+	fs = crossDeviceFs{Fs: base, failWrites: true}
+	fsutil = &afero.Afero{Fs: fs}
+
+	if err := (FileRename{OldFileName: "a.mkv", NewFileName: "other/A.mkv", Action: ActionMove}).RenameFile(); err == nil {
+		t.Errorf("RenameFile() with %q succeeded without copying anything", ActionMove)
+	}
+
+	if exists, _ := afero.Exists(fs, "a.mkv"); !exists {
+		t.Errorf("RenameFile() with %q removed the original after failing", ActionMove)
+	}
+	for _, v := range []string{"other/A.mkv", "other/A.mkv.partial"} {
+		if exists, _ := afero.Exists(fs, v); exists {
+			t.Errorf("RenameFile() with %q left %v behind", ActionMove, v)
+		}
+	}
+}
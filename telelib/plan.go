@@ -0,0 +1,350 @@
+package telelib
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Lookup retrieves the episode information for a file, e.g. from TVDB.
+type Lookup func(RawFileInfo) (ParsedFileInfo, error)
+
+// Namer works out the new name of a file from its episode information.
+type Namer func(ParsedFileInfo) FileRename
+
+// TVDBLookup looks files up on TVDB with the given login.
+func TVDBLookup(login TVDBLogin) Lookup {
+	return func(fileInfo RawFileInfo) (ParsedFileInfo, error) {
+		return fileInfo.RetrieveEpisodeInfo(login)
+	}
+}
+
+// FormatNamer names files with a format string, as with ParsedFileInfo.NewFileNameWithOptions.
+func FormatNamer(format string, opts NamingOptions) Namer {
+	return func(p ParsedFileInfo) FileRename {
+		return p.NewFileNameWithOptions(format, opts)
+	}
+}
+
+// PresetNamer names files following a preset, as with Preset.NewFileNameWithOptions.
+func PresetNamer(preset Preset, opts NamingOptions) Namer {
+	return func(p ParsedFileInfo) FileRename {
+		return preset.NewFileNameWithOptions(p, opts)
+	}
+}
+
+// FileState is a snapshot of a file, used to check it hasn't changed since a plan was made.
+type FileState struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modtime"`
+}
+
+// PlanEntry is a single proposed rename within a plan.
+type PlanEntry struct {
+	FileRename
+	// Info is the episode information the new name was built from.
+	Info ParsedFileInfo `json:"info"`
+	// Source is the state of the file when the plan was made.
+	Source *FileState `json:"source,omitempty"`
+	// Error is why the file can't be renamed. Entries with errors are never applied.
+	Error string `json:"error,omitempty"`
+	// Warnings are problems that don't stop the rename, but are worth knowing about.
+	Warnings []string `json:"warnings,omitempty"`
+	// Skip leaves the file as it is when the plan is applied.
+	Skip bool `json:"skip,omitempty"`
+	// Folder is set when the entry renames a folder, rather than a file. See RenameFolders.
+	Folder bool `json:"folder,omitempty"`
+}
+
+// Plan is every rename we intend to perform. Looking files up and renaming them are kept separate, so a plan
+// can be inspected, filtered, saved or edited before it is applied.
+type Plan struct {
+	Entries []PlanEntry `json:"entries"`
+}
+
+// NewPlan looks up every file, and works out its new name, without renaming anything.
+// Entries are in the same order as the files given.
+func NewPlan(files []RawFileInfo, lookup Lookup, namer Namer) Plan {
+	// Lookups are slow, so they happen concurrently, but each gets its own channel to keep the plan in order.
+	var entryChans []chan PlanEntry
+	for _, v := range files {
+		entryChan := make(chan PlanEntry, 1)
+		entryChans = append(entryChans, entryChan)
+
+		go func(v RawFileInfo, entryChan chan PlanEntry) {
+			epInfo, err := lookup(v)
+			if err != nil {
+				entryChan <- PlanEntry{
+					FileRename: FileRename{OldFileName: v.FileName},
+					Error:      fmt.Sprintf("error retrieving episode info for series %v, season %v, episode %v: %v", v.Series, v.Season, v.Episode, err),
+				}
+				return
+			}
+
+			entry := PlanEntry{FileRename: namer(epInfo), Info: epInfo, Source: statFile(v.FileName)}
+			// Files that are already named correctly are left as they are, so running twice changes nothing.
+			entry.Skip = entry.Unchanged()
+			entryChan <- entry
+		}(v, entryChan)
+	}
+
+	var plan Plan
+	for _, v := range entryChans {
+		plan.Entries = append(plan.Entries, <-v)
+	}
+
+	return plan
+}
+
+// statFile takes a snapshot of a file, or returns nil if it can't be read.
+func statFile(fileName string) *FileState {
+	info, err := fs.Stat(fileName)
+	if err != nil {
+		return nil
+	}
+
+	return &FileState{Size: info.Size(), ModTime: info.ModTime()}
+}
+
+// Pending reports whether the entry will be renamed when the plan is applied.
+func (entry PlanEntry) Pending() bool {
+	return entry.Error == "" && !entry.Skip
+}
+
+// Unchanged reports whether the entry's new name is the name it already has, however either path is written, e.g.
+// "./Show.mkv" and "Show.mkv", so that a file never collides with itself.
+func (entry PlanEntry) Unchanged() bool {
+	return filepath.Clean(entry.NewFileName) == filepath.Clean(entry.OldFileName)
+}
+
+// Renames lists the renames that will be performed when the plan is applied.
+func (plan Plan) Renames() []FileRename {
+	var renames []FileRename
+	for _, v := range plan.Entries {
+		if v.Pending() && !v.Unchanged() {
+			renames = append(renames, v.FileRename)
+		}
+	}
+
+	return renames
+}
+
+// Failed lists the entries that can't be renamed.
+func (plan Plan) Failed() []PlanEntry {
+	var failed []PlanEntry
+	for _, v := range plan.Entries {
+		if v.Error != "" {
+			failed = append(failed, v)
+		}
+	}
+
+	return failed
+}
+
+// Filter returns a plan with only the entries keep returns true for.
+func (plan Plan) Filter(keep func(PlanEntry) bool) Plan {
+	var filtered Plan
+	for _, v := range plan.Entries {
+		if keep(v) {
+			filtered.Entries = append(filtered.Entries, v)
+		}
+	}
+
+	return filtered
+}
+
+// WithAction returns a plan where every entry is performed with the action, e.g. hardlinked rather than renamed.
+func (plan Plan) WithAction(action Action) Plan {
+	var changed Plan
+	for _, v := range plan.Entries {
+		v.Action = action
+		changed.Entries = append(changed.Entries, v)
+	}
+
+	return changed
+}
+
+// Absolute returns a plan where every file is given by its absolute path, so that the renames it journals can be
+// undone from any directory.
+func (plan Plan) Absolute() (Plan, error) {
+	var absolute Plan
+	for _, v := range plan.Entries {
+		for _, name := range []*string{&v.OldFileName, &v.NewFileName} {
+			if *name == "" {
+				continue
+			}
+			abs, err := filepath.Abs(*name)
+			if err != nil {
+				return Plan{}, fmt.Errorf("error finding absolute path %v", err)
+			}
+			*name = abs
+		}
+		absolute.Entries = append(absolute.Entries, v)
+	}
+
+	return absolute, nil
+}
+
+// Directories lists the folders holding every file the plan renames, in order.
+func (plan Plan) Directories() []string {
+	found := make(map[string]bool)
+	var dirs []string
+	for _, v := range plan.Entries {
+		dir := filepath.Dir(v.OldFileName)
+		if v.Pending() && !found[dir] {
+			found[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	sort.Strings(dirs)
+	return dirs
+}
+
+// ApplyOptions changes how ApplyWithOptions performs a plan.
+type ApplyOptions struct {
+	// Atomic makes the plan all-or-nothing: if any rename fails, every rename already performed is rolled back.
+	Atomic bool
+	// JournalPath is where the journal is written, ahead of every rename. Without one, an interrupted run
+	// can't be undone.
+	JournalPath string
+	// Progress is called as files are copied, such as when moving files to another filesystem.
+	Progress func(file FileRename, copied int64, total int64)
+}
+
+// Apply performs every pending rename in the plan, in order. Returns the renames that succeeded, so that they
+// can be undone, along with an error for every rename that didn't.
+func (plan Plan) Apply() ([]FileRename, []error) {
+	return plan.ApplyWithOptions(ApplyOptions{})
+}
+
+// ApplyWithOptions performs every pending rename in the plan, as described by the options.
+// When atomic, everything is rolled back if anything fails, so only the renames the rollback couldn't reverse are
+// returned as renamed, along with an error for each, after the error that caused the rollback.
+func (plan Plan) ApplyWithOptions(opts ApplyOptions) ([]FileRename, []error) {
+	journal := &Journal{}
+	if opts.JournalPath != "" {
+		var err error
+		if journal, err = OpenJournal(opts.JournalPath); err != nil {
+			return nil, []error{err}
+		}
+	}
+	defer journal.Close()
+
+	var errs []error
+	for _, v := range plan.Entries {
+		// Plans may have been edited by hand, so entries that wouldn't change anything are checked for again.
+		if !v.Pending() || v.Unchanged() {
+			continue
+		}
+
+		// A rename that can't be journalled can't be undone, so isn't attempted.
+		err := journal.Begin(v.FileRename)
+		if err == nil {
+			if err = v.RenameFileWithProgress(opts.progress(v.FileRename)); err == nil {
+				err = journal.Record(v.FileRename)
+			}
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %v", v.OldFileName, err))
+			if opts.Atomic {
+				errs = append(errs, journal.Rollback()...)
+				return journal.Completed, errs
+			}
+		}
+	}
+
+	return journal.Completed, errs
+}
+
+// progress reports the progress of copying a single file.
+func (opts ApplyOptions) progress(file FileRename) Progress {
+	if opts.Progress == nil {
+		return nil
+	}
+	return func(copied int64, total int64) {
+		opts.Progress(file, copied, total)
+	}
+}
+
+// Verify checks every pending rename in a plan can still be performed: the file still exists, hasn't changed
+// since the plan was made, and has a new name to go to. Plans may have been edited by hand, so nothing is assumed.
+func (plan Plan) Verify() []error {
+	var errs []error
+
+	for _, v := range plan.Entries {
+		if !v.Pending() {
+			continue
+		}
+
+		if v.NewFileName == "" {
+			errs = append(errs, fmt.Errorf("%v: no new file name", v.OldFileName))
+			continue
+		}
+
+		current := statFile(v.OldFileName)
+		if current == nil {
+			errs = append(errs, fmt.Errorf("%v: file no longer exists", v.OldFileName))
+		} else if v.Source != nil && (current.Size != v.Source.Size || !current.ModTime.Equal(v.Source.ModTime)) {
+			errs = append(errs, fmt.Errorf("%v: file has changed since the plan was made", v.OldFileName))
+		}
+	}
+
+	return errs
+}
+
+// SavePlan writes a plan to a file, to be reviewed or edited and applied later. Paths ending in ".yaml" or ".yml"
+// are written as YAML, with the same fields as JSON, and anything else as JSON.
+func SavePlan(plan Plan, path string) error {
+	var contents []byte
+	var err error
+	if isYAML(path) {
+		contents, err = yaml.Marshal(plan)
+		if err != nil {
+			return fmt.Errorf("error converting plan to YAML %v", err)
+		}
+	} else {
+		contents, err = json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error converting plan to JSON %v", err)
+		}
+	}
+
+	if err := fsutil.WriteFile(path, contents, 0644); err != nil {
+		return fmt.Errorf("error writing plan %v", err)
+	}
+
+	return nil
+}
+
+// LoadPlan reads a plan written by SavePlan, as YAML or JSON depending on its extension.
+func LoadPlan(path string) (Plan, error) {
+	contents, err := fsutil.ReadFile(path)
+	if err != nil {
+		return Plan{}, fmt.Errorf("error reading plan %v", err)
+	}
+
+	var plan Plan
+	if isYAML(path) {
+		err = yaml.Unmarshal(contents, &plan)
+	} else {
+		err = json.Unmarshal(contents, &plan)
+	}
+	if err != nil {
+		return Plan{}, fmt.Errorf("error parsing plan %v", err)
+	}
+
+	return plan, nil
+}
+
+// isYAML reports whether a plan file is YAML, rather than JSON, from its extension.
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
@@ -0,0 +1,219 @@
+package telelib
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+)
+
+// fakeLookup stands in for TVDB, naming every episode after its number.
+func fakeLookup(fileInfo RawFileInfo) (ParsedFileInfo, error) {
+	if fileInfo.Series == "Unknown" {
+		return ParsedFileInfo{}, errors.New("series not found")
+	}
+
+	return ParsedFileInfo{
+		FileName:    fileInfo.FileName,
+		Container:   fileInfo.Container,
+		Season:      fileInfo.Season,
+		Episode:     fileInfo.Episode,
+		EpisodeName: "Episode " + strconv.Itoa(fileInfo.Episode),
+		Series:      "The Good Place",
+	}, nil
+}
+
+func TestNewPlan(t *testing.T) {
+	files := []RawFileInfo{
+		{FileName: "the.good.place.s04e07.mkv", Container: "mkv", Season: 4, Episode: 7, Series: "the good place"},
+		{FileName: "unknown.s01e01.mkv", Container: "mkv", Season: 1, Episode: 1, Series: "Unknown"},
+		{FileName: "the.good.place.s04e08.mkv", Container: "mkv", Season: 4, Episode: 8, Series: "the good place"},
+	}
+
+	plan := NewPlan(files, fakeLookup, FormatNamer("{s} - S{0z}E{0e} - {n}", NamingOptions{}))
+
+	if len(plan.Entries) != len(files) {
+		t.Fatalf("NewPlan() has %v entries, expected %v", len(plan.Entries), len(files))
+	}
+
+	expected := []FileRename{
+		{OldFileName: "the.good.place.s04e07.mkv", NewFileName: "The Good Place - S04E07 - Episode 7.mkv"},
+		{OldFileName: "the.good.place.s04e08.mkv", NewFileName: "The Good Place - S04E08 - Episode 8.mkv"},
+	}
+	if !cmp.Equal(plan.Renames(), expected) {
+		t.Errorf("NewPlan().Renames() == %+v, expected %+v", plan.Renames(), expected)
+	}
+
+	// Files that already have their new name are left as they are.
+	unchanged := NewPlan([]RawFileInfo{{FileName: "The Good Place - S04E07 - Episode 7.mkv", Container: "mkv", Season: 4, Episode: 7, Series: "The Good Place"}}, fakeLookup, FormatNamer("{s} - S{0z}E{0e} - {n}", NamingOptions{}))
+	if entry := unchanged.Entries[0]; !entry.Unchanged() || entry.Pending() {
+		t.Errorf("NewPlan() == %+v, expected the file to be left unchanged", entry)
+	}
+	unclean := NewPlan([]RawFileInfo{{FileName: "./The Good Place - S04E07 - Episode 7.mkv", Container: "mkv", Season: 4, Episode: 7, Series: "The Good Place"}}, fakeLookup, FormatNamer("{s} - S{0z}E{0e} - {n}", NamingOptions{}))
+	if entry := unclean.Entries[0]; !entry.Unchanged() || entry.Pending() {
+		t.Errorf("NewPlan() == %+v, expected the file to be left unchanged however its path is written", entry)
+	}
+
+	failed := plan.Failed()
+	if len(failed) != 1 || failed[0].OldFileName != "unknown.s01e01.mkv" {
+		t.Errorf("NewPlan().Failed() == %+v, expected only unknown.s01e01.mkv", failed)
+	}
+}
+
+func TestPlanFilter(t *testing.T) {
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: "a.mkv", NewFileName: "A.mkv"}},
+		{FileRename: FileRename{OldFileName: "b.srt", NewFileName: "B.srt"}},
+	}}
+
+	filtered := plan.Filter(func(entry PlanEntry) bool {
+		return entry.OldFileName == "a.mkv"
+	})
+
+	if len(filtered.Entries) != 1 || filtered.Entries[0].OldFileName != "a.mkv" {
+		t.Errorf("Plan.Filter() == %+v, expected only a.mkv", filtered)
+	}
+}
+
+func TestPlanAbsolute(t *testing.T) {
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: "tv/a.mkv", NewFileName: "tv/A.mkv"}},
+		{FileRename: FileRename{OldFileName: "/films/b.mkv", NewFileName: "/films/B.mkv"}},
+		{FileRename: FileRename{OldFileName: "tv/c.mkv"}, Error: "lookup failed"},
+	}}
+
+	absolute, err := plan.Absolute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileRename{
+		{OldFileName: filepath.Join(current, "tv/a.mkv"), NewFileName: filepath.Join(current, "tv/A.mkv")},
+		{OldFileName: "/films/b.mkv", NewFileName: "/films/B.mkv"},
+		{OldFileName: filepath.Join(current, "tv/c.mkv")},
+	}
+	for i, v := range absolute.Entries {
+		if v.FileRename != want[i] {
+			t.Errorf("Plan.Absolute().Entries[%v] == %+v, expected %+v", i, v.FileRename, want[i])
+		}
+	}
+
+	// Failed entries aren't renamed, so their folders aren't targeted.
+	if dirs := absolute.Directories(); !cmp.Equal(dirs, []string{"/films", filepath.Join(current, "tv")}) {
+		t.Errorf("Plan.Directories() == %v, expected /films and tv", dirs)
+	}
+}
+
+func TestPlanApply(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	for _, v := range []string{"a.mkv", "b.mkv", "c.mkv"} {
+		afero.WriteFile(fs, v, []byte("random contents"), 0644)
+	}
+
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: "a.mkv", NewFileName: "A.mkv"}},
+		{FileRename: FileRename{OldFileName: "b.mkv", NewFileName: "B.mkv"}, Skip: true},
+		{FileRename: FileRename{OldFileName: "c.mkv"}, Error: "lookup failed"},
+		{FileRename: FileRename{OldFileName: "missing.mkv", NewFileName: "Missing.mkv"}},
+	}}
+
+	renamed, errs := plan.Apply()
+
+	if !cmp.Equal(renamed, []FileRename{{OldFileName: "a.mkv", NewFileName: "A.mkv"}}) {
+		t.Errorf("Plan.Apply() renamed %+v, expected only a.mkv", renamed)
+	}
+	if len(errs) != 1 {
+		t.Errorf("Plan.Apply() returned errors %v, expected one for missing.mkv", errs)
+	}
+
+	for _, v := range []string{"A.mkv", "b.mkv", "c.mkv"} {
+		exists, err := afero.Exists(fs, v)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !exists {
+			t.Errorf("Plan.Apply() - %q was not found", v)
+		}
+	}
+}
+
+func TestPlanVerify(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	for _, v := range []string{"a.mkv", "b.mkv", "c.mkv"} {
+		afero.WriteFile(fs, v, []byte("random contents"), 0644)
+	}
+
+	plan := Plan{Entries: []PlanEntry{
+		{FileRename: FileRename{OldFileName: "a.mkv", NewFileName: "A.mkv"}, Source: statFile("a.mkv")},
+		{FileRename: FileRename{OldFileName: "b.mkv", NewFileName: "B.mkv"}, Source: statFile("b.mkv")},
+		{FileRename: FileRename{OldFileName: "c.mkv", NewFileName: ""}, Source: statFile("c.mkv")},
+		{FileRename: FileRename{OldFileName: "d.mkv", NewFileName: "D.mkv"}},
+	}}
+
+	if errs := plan.Filter(func(entry PlanEntry) bool { return entry.OldFileName == "a.mkv" }).Verify(); len(errs) != 0 {
+		t.Errorf("Plan.Verify() == %v, expected no errors", errs)
+	}
+
+	afero.WriteFile(fs, "b.mkv", []byte("different, longer contents"), 0644)
+
+	// b.mkv has changed, c.mkv has no new name, and d.mkv doesn't exist.
+	if errs := plan.Verify(); len(errs) != 3 {
+		t.Errorf("Plan.Verify() == %v, expected 3 errors", errs)
+	}
+}
+
+func TestSaveLoadPlan(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	afero.WriteFile(fs, "a.mkv", []byte("random contents"), 0644)
+
+	plan := Plan{Entries: []PlanEntry{
+		{
+			FileRename: FileRename{OldFileName: "a.mkv", NewFileName: "A.mkv"},
+			Info:       ParsedFileInfo{FileName: "a.mkv", Container: "mkv", Season: 1, Episode: 2, Series: "A"},
+			Source:     statFile("a.mkv"),
+		},
+		{FileRename: FileRename{OldFileName: "b.mkv"}, Error: "lookup failed"},
+	}}
+
+	if err := SavePlan(plan, "plan.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SavePlan(plan, "plan.yaml"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"plan.json", "plan.yaml"} {
+		result, err := LoadPlan(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !cmp.Equal(result, plan) {
+			t.Errorf("LoadPlan(%q) == %+v, expected %+v", path, result, plan)
+		}
+		if errs := result.Verify(); len(errs) != 0 {
+			t.Errorf("LoadPlan(%q).Verify() == %v, expected no errors", path, errs)
+		}
+	}
+
+	// YAML plans use the same fields as JSON plans.
+	if contents, _ := afero.ReadFile(fs, "plan.yaml"); !strings.Contains(string(contents), "oldfilename: a.mkv") {
+		t.Errorf("SavePlan() wrote %q to plan.yaml, expected YAML", contents)
+	}
+}
@@ -0,0 +1,89 @@
+package telelib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Preset is a named format that follows a media server's recommended folder and file naming conventions.
+type Preset struct {
+	// Format is used for regular episodes. Folders are separated with "/".
+	Format string
+	// SpecialsFormat is used for episodes in season 0, as most media servers keep specials in their own folder.
+	SpecialsFormat string
+	// MultiEpisode is what {m} becomes when a file contains more than one episode.
+	MultiEpisode string
+}
+
+// Presets are the supported media server presets, keyed by the name used on the command line.
+var Presets = map[string]Preset{
+	// https://support.plex.tv/articles/naming-and-organizing-your-tv-show-files/
+	"plex": {
+		Format:         "{s}/Season {0z}/{s} - S{0z}E{0e}{m} - {n}",
+		SpecialsFormat: "{s}/Specials/{s} - S00E{0e}{m} - {n}",
+		MultiEpisode:   "-E{0le}",
+	},
+	// https://jellyfin.org/docs/general/server/media/shows
+	"jellyfin": {
+		Format:         "{s}/Season {0z}/{s} S{0z}E{0e}{m} - {n}",
+		SpecialsFormat: "{s}/Season 00/{s} S00E{0e}{m} - {n}",
+		MultiEpisode:   "-E{0le}",
+	},
+	// https://kodi.wiki/view/Naming_video_files/TV_shows
+	"kodi": {
+		Format:         "{s}/Season {z}/{s} S{0z}E{0e}{m} - {n}",
+		SpecialsFormat: "{s}/Specials/{s} S00E{0e}{m} - {n}",
+		MultiEpisode:   "E{0le}",
+	},
+	// https://emby.media/support/articles/TV-Naming.html
+	"emby": {
+		Format:         "{s}/Season {0z}/{s} - S{0z}E{0e}{m} - {n}",
+		SpecialsFormat: "{s}/Specials/{s} - S00E{0e}{m} - {n}",
+		MultiEpisode:   "-E{0le}",
+	},
+}
+
+// PresetNames returns the names of every preset, sorted.
+func PresetNames() []string {
+	var names []string
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// GetPreset retrieves a preset by name, ignoring case.
+func GetPreset(name string) (Preset, error) {
+	preset, ok := Presets[strings.ToLower(name)]
+	if !ok {
+		return Preset{}, fmt.Errorf("unknown preset %q, expected one of %v", name, PresetNames())
+	}
+
+	return preset, nil
+}
+
+// FormatFor returns the format string the preset uses for a given episode.
+func (preset Preset) FormatFor(p ParsedFileInfo) string {
+	format := preset.Format
+	if p.Season == 0 && preset.SpecialsFormat != "" {
+		format = preset.SpecialsFormat
+	}
+
+	if p.LastEpisode > p.Episode {
+		return strings.ReplaceAll(format, "{m}", preset.MultiEpisode)
+	}
+	return strings.ReplaceAll(format, "{m}", "")
+}
+
+// NewFileName returns a file name following the preset.
+func (preset Preset) NewFileName(p ParsedFileInfo) FileRename {
+	return preset.NewFileNameWithOptions(p, NamingOptions{})
+}
+
+// NewFileNameWithOptions returns a file name following the preset, sanitized and cleaned up as described by the options.
+func (preset Preset) NewFileNameWithOptions(p ParsedFileInfo, opts NamingOptions) FileRename {
+	return p.NewFileNameWithOptions(preset.FormatFor(p), opts)
+}
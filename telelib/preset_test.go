@@ -0,0 +1,66 @@
+package telelib
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPresetNewFileName(t *testing.T) {
+	cases := []struct {
+		preset string
+		in     ParsedFileInfo
+		want   string
+	}{
+		{
+			"plex",
+			ParsedFileInfo{Container: "mkv", Series: "The Good Place", Season: 4, Episode: 7, EpisodeName: "Help Is Other People"},
+			"The Good Place/Season 04/The Good Place - S04E07 - Help Is Other People.mkv",
+		},
+		{
+			"plex",
+			ParsedFileInfo{Container: "mkv", Series: "The Good Place", Season: 0, Episode: 1, EpisodeName: "Mini Episode"},
+			"The Good Place/Specials/The Good Place - S00E01 - Mini Episode.mkv",
+		},
+		{
+			"plex",
+			ParsedFileInfo{Container: "mkv", Series: "The Good Place", Season: 1, Episode: 1, LastEpisode: 2, EpisodeName: "Everything Is Fine"},
+			"The Good Place/Season 01/The Good Place - S01E01-E02 - Everything Is Fine.mkv",
+		},
+		{
+			"jellyfin",
+			ParsedFileInfo{Container: "mp4", Series: "The Good Place", Season: 0, Episode: 3, EpisodeName: "Mini Episode"},
+			"The Good Place/Season 00/The Good Place S00E03 - Mini Episode.mp4",
+		},
+		{
+			"kodi",
+			ParsedFileInfo{Container: "mkv", Series: "The Good Place", Season: 1, Episode: 1, LastEpisode: 2, EpisodeName: "Everything Is Fine"},
+			"The Good Place/Season 1/The Good Place S01E01E02 - Everything Is Fine.mkv",
+		},
+		{
+			"emby",
+			ParsedFileInfo{Container: "mkv", Series: "Face/Off", Season: 2, Episode: 3, EpisodeName: "Pilot"},
+			"FaceOff/Season 02/FaceOff - S02E03 - Pilot.mkv",
+		},
+	}
+
+	for _, v := range cases {
+		preset, err := GetPreset(v.preset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := preset.NewFileName(v.in)
+		if result.NewFileName != filepath.FromSlash(v.want) {
+			t.Errorf("%v.NewFileName(%+v) = %q, expected %q", v.preset, v.in, result.NewFileName, v.want)
+		}
+	}
+}
+
+func TestGetPreset(t *testing.T) {
+	if _, err := GetPreset("PLEX"); err != nil {
+		t.Errorf("GetPreset(%q) returned error %v", "PLEX", err)
+	}
+	if _, err := GetPreset("vlc"); err == nil {
+		t.Errorf("GetPreset(%q) returned no error", "vlc")
+	}
+}
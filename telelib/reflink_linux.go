@@ -0,0 +1,51 @@
+//go:build linux
+// +build linux
+
+package telelib
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/spf13/afero"
+)
+
+// ficlone is the FICLONE ioctl, which makes one file share another's data until either is changed.
+const ficlone = 0x40049409
+
+// reflinkFile makes a copy-on-write copy of a file. Only possible on the OS filesystem, and filesystems that
+// support it.
+func reflinkFile(oldFileName string, newFileName string) error {
+	if _, ok := fs.(*afero.OsFs); !ok {
+		return fmt.Errorf("error reflinking %v: reflinks are not supported by %v", oldFileName, fs.Name())
+	}
+
+	info, err := os.Stat(oldFileName)
+	if err != nil {
+		return fmt.Errorf("error reflinking %v", err)
+	}
+
+	src, err := os.Open(oldFileName)
+	if err != nil {
+		return fmt.Errorf("error reflinking %v", err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(newFileName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("error reflinking %v", err)
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	dst.Close()
+	if errno != 0 {
+		os.Remove(newFileName)
+		return fmt.Errorf("error reflinking %v: %v", oldFileName, errno)
+	}
+
+	if err := os.Chtimes(newFileName, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("error copying modification time %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package telelib
+
+import "fmt"
+
+// reflinkFile makes a copy-on-write copy of a file. Only supported on Linux.
+func reflinkFile(oldFileName string, newFileName string) error {
+	return fmt.Errorf("error reflinking %v: reflinks are only supported on Linux", oldFileName)
+}
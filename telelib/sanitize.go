@@ -0,0 +1,186 @@
+package telelib
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// SanitizePolicy decides which characters and names are allowed within a file name.
+type SanitizePolicy string
+
+const (
+	// SanitizeWindows removes the characters Windows does not accept in file names, renames reserved device names
+	// (CON, NUL, etc.) and trims dots and spaces from the end of folder and file names. This is the default, as it has
+	// always been telenamer's behaviour.
+	SanitizeWindows SanitizePolicy = "windows"
+	// SanitizePosix only removes "/" and NUL, the only characters POSIX filesystems reject.
+	SanitizePosix SanitizePolicy = "posix"
+	// SanitizePortable is for files that move between systems, or live on SMB shares: everything SanitizeWindows does,
+	// while also trimming leading dots and spaces, which hide files or confuse tools on other platforms.
+	SanitizePortable SanitizePolicy = "portable"
+)
+
+// NamingOptions changes how NewFileNameWithOptions builds a file name.
+type NamingOptions struct {
+	// Sanitize is the policy used to clean up file names. Defaults to SanitizeWindows.
+	Sanitize SanitizePolicy
+	// Replacements are made within the series and episode names before sanitizing, e.g. ":" to " -", so that
+	// "Star Trek: Picard" becomes "Star Trek - Picard" rather than "Star Trek Picard".
+	Replacements map[string]string
+	// MaxLength is the longest a folder or file name (including its extension) can be, in bytes. Defaults to
+	// DefaultMaxLength, the limit of almost every filesystem, and can't be less than MinMaxLength.
+	MaxLength int
+	// Normalize converts series and episode names to a Unicode normalization form.
+	Normalize Normalization
+	// Transliterate converts series and episode names to ASCII, e.g. "Pokémon" to "Pokemon". Names that would lose
+	// most of their letters, such as those in Japanese, are left as they are.
+	Transliterate bool
+	// BaseDir is where the folders of formats with folders are created, such as the top of a folder of downloads.
+	// Defaults to the folder of each file. Formats without folders always keep files in their own folder.
+	BaseDir string
+	// DestDir is where every file is placed, such as a library, whether or not the format has folders.
+	// Takes priority over BaseDir.
+	DestDir string
+}
+
+// DefaultMaxLength is the maximum length of a file name in bytes, unless NamingOptions says otherwise.
+const DefaultMaxLength = 255
+
+// MinMaxLength is the shortest maximum length NamingOptions.Validate accepts, which leaves room for a few characters of
+// the name alongside its extension, or a companion's, such as ".en.sdh.forced.srt".
+const MinMaxLength = 32
+
+// Validate checks the options can name files at all.
+func (opts NamingOptions) Validate() error {
+	if opts.MaxLength != 0 && opts.MaxLength < MinMaxLength {
+		return fmt.Errorf("maximum length %v is too short to fit a name and its extension, expected at least %v", opts.MaxLength, MinMaxLength)
+	}
+	return nil
+}
+
+// SanitizePolicies lists the names accepted by ParseSanitizePolicy.
+var SanitizePolicies = []string{string(SanitizeWindows), string(SanitizePosix), string(SanitizePortable), "smb"}
+
+// ParseSanitizePolicy retrieves a policy from its name. "smb" is accepted as another name for "portable".
+func ParseSanitizePolicy(name string) (SanitizePolicy, error) {
+	switch strings.ToLower(name) {
+	case "", string(SanitizeWindows):
+		return SanitizeWindows, nil
+	case string(SanitizePosix):
+		return SanitizePosix, nil
+	case string(SanitizePortable), "smb":
+		return SanitizePortable, nil
+	}
+
+	return "", fmt.Errorf("unknown sanitization policy %q, expected one of %v", name, SanitizePolicies)
+}
+
+// ParseReplacements turns a list of "from=to" pairs into a replacement map, e.g. ":= -" replaces ":" with " -".
+func ParseReplacements(pairs []string) (map[string]string, error) {
+	replacements := make(map[string]string)
+	for _, pair := range pairs {
+		// Splitting on the first "=" lets "=" be a replacement, but not be replaced.
+		i := strings.Index(pair, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("replacement %q is not in the format from=to", pair)
+		}
+		replacements[pair[:i]] = pair[i+1:]
+	}
+
+	return replacements, nil
+}
+
+var (
+	windowsInvalidRe  = regexp.MustCompile(`[\x00-\x1f?\\/*:"<>|]`)
+	posixInvalidRe    = regexp.MustCompile(`[\x00/]`)
+	windowsReservedRe = regexp.MustCompile(`(?i)^(con|prn|aux|nul|com[1-9]|lpt[1-9])$`)
+)
+
+// replace performs the configured replacements on a series or episode name.
+func (opts NamingOptions) replace(name string) string {
+	// Maps are unordered, so longer matches go first to keep the result predictable when replacements overlap.
+	var from []string
+	for k := range opts.Replacements {
+		from = append(from, k)
+	}
+	sort.Slice(from, func(i, j int) bool {
+		if len(from[i]) != len(from[j]) {
+			return len(from[i]) > len(from[j])
+		}
+		return from[i] < from[j]
+	})
+
+	for _, k := range from {
+		name = strings.ReplaceAll(name, k, opts.Replacements[k])
+	}
+
+	return name
+}
+
+// sanitize cleans up a single folder or file name (without its extension) according to the policy. Trailing dots and
+// spaces are only removed from folders, as a file name ends with its extension.
+func (opts NamingOptions) sanitize(name string, folder bool) string {
+	if opts.Sanitize == SanitizePosix {
+		return escapeDots(posixInvalidRe.ReplaceAllString(name, ""))
+	}
+
+	name = windowsInvalidRe.ReplaceAllString(name, "")
+	if folder {
+		name = opts.trimEnd(name)
+	}
+	if opts.Sanitize == SanitizePortable {
+		name = strings.TrimLeft(name, ". ")
+	}
+
+	// Device names are reserved regardless of their extension, so "CON.mkv" can't be created either.
+	stem := strings.SplitN(name, ".", 2)[0]
+	if windowsReservedRe.MatchString(strings.TrimSpace(stem)) {
+		name = strings.Replace(name, stem, stem+"_", 1)
+	}
+
+	return escapeDots(name)
+}
+
+// escapeDots replaces a name of "." or "..", which would refer to the current or parent folder rather than a folder of
+// its own, e.g. a series named "..".
+func escapeDots(name string) string {
+	if name == "." || name == ".." {
+		return strings.Repeat("_", len(name))
+	}
+	return name
+}
+
+// trimEnd removes the trailing dots and spaces Windows silently drops from the end of a name, so that the name on disk
+// matches the one we report.
+func (opts NamingOptions) trimEnd(name string) string {
+	if opts.Sanitize == SanitizePosix {
+		return name
+	}
+	return strings.TrimRight(name, ". ")
+}
+
+// maxLength returns the configured maximum length of a file name, or the default if none is set.
+func (opts NamingOptions) maxLength() int {
+	if opts.MaxLength <= 0 {
+		return DefaultMaxLength
+	}
+	return opts.MaxLength
+}
+
+// truncate shortens a string to at most n bytes, without cutting a multi-byte character in half.
+func truncate(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,218 @@
+package telelib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewFileNameWithOptions(t *testing.T) {
+	in := ParsedFileInfo{Container: "mkv", Series: "Star Trek: Picard", Season: 1, Episode: 1, EpisodeName: "Remembrance"}
+
+	cases := []struct {
+		in   ParsedFileInfo
+		opts NamingOptions
+		want string
+	}{
+		{
+			in,
+			NamingOptions{},
+			"Star Trek Picard - S01E01 - Remembrance.mkv",
+		},
+		{
+			in,
+			NamingOptions{Sanitize: SanitizePosix},
+			"Star Trek: Picard - S01E01 - Remembrance.mkv",
+		},
+		{
+			in,
+			NamingOptions{Sanitize: SanitizeWindows, Replacements: map[string]string{":": " -"}},
+			"Star Trek - Picard - S01E01 - Remembrance.mkv",
+		},
+		{
+			ParsedFileInfo{Container: "mkv", Series: "AC/DC", Season: 1, Episode: 1, EpisodeName: "Who?"},
+			NamingOptions{Sanitize: SanitizePosix},
+			"ACDC - S01E01 - Who?.mkv",
+		},
+		{
+			// Only the end of the whole name matters, so dots before the extension are kept.
+			ParsedFileInfo{Container: "mkv", Series: "Lost", Season: 1, Episode: 1, EpisodeName: "Previously On..."},
+			NamingOptions{},
+			"Lost - S01E01 - Previously On....mkv",
+		},
+	}
+
+	for _, v := range cases {
+		result := v.in.NewFileNameWithOptions("{s} - S{0z}E{0e} - {n}", v.opts)
+
+		if result.NewFileName != v.want {
+			t.Errorf("%+v.NewFileNameWithOptions(%+v) = %q, expected %q", v.in, v.opts, result.NewFileName, v.want)
+		}
+	}
+}
+
+func TestNewFileNameDotFolders(t *testing.T) {
+	in := ParsedFileInfo{FileName: "tv/a.mkv", Container: "mkv", Series: "..", Season: 1, Episode: 1, EpisodeName: "Pilot"}
+
+	// A series named ".." mustn't move the file out of the folder it is in.
+	for _, policy := range []SanitizePolicy{SanitizeWindows, SanitizePosix, SanitizePortable} {
+		result := in.NewFileNameWithOptions("{s}/{s} - S{0z}E{0e}", NamingOptions{Sanitize: policy})
+
+		if !strings.HasPrefix(result.NewFileName, "tv/") || strings.Contains(result.NewFileName, "../") {
+			t.Errorf("%+v.NewFileNameWithOptions() with %v = %q, which is outside of tv", in, policy, result.NewFileName)
+		}
+	}
+}
+
+func TestNewFileNameMaxLength(t *testing.T) {
+	cases := []struct {
+		in   ParsedFileInfo
+		max  int
+		want string
+	}{
+		{
+			ParsedFileInfo{Container: "mkv", Series: "The Good Place", Season: 4, Episode: 7, EpisodeName: "Help Is Other People"},
+			40,
+			"The Good Place - S04E07 - Help Is Ot.mkv",
+		},
+		{
+			// Cutting the title to fit would leave a trailing space, which is removed.
+			ParsedFileInfo{Container: "mkv", Series: "The Good Place", Season: 4, Episode: 7, EpisodeName: "Help Is Other People"},
+			38,
+			"The Good Place - S04E07 - Help Is.mkv",
+		},
+		{
+			// "é" is two bytes, and can't be cut in half.
+			ParsedFileInfo{Container: "mkv", Series: "Pokémon", Season: 1, Episode: 1, EpisodeName: "Pokémon - I Choose You!"},
+			28,
+			"Pokémon - S01E01 - Pok.mkv",
+		},
+		{
+			// With no title left to cut, the rest of the name is shortened, but the extension is kept.
+			ParsedFileInfo{Container: "mkv", Series: "The Good Place", Season: 4, Episode: 7, EpisodeName: "Help Is Other People"},
+			20,
+			"The Good Place -.mkv",
+		},
+		{
+			ParsedFileInfo{Container: "mkv", Series: "The Good Place", Season: 4, Episode: 7, EpisodeName: "Help Is Other People"},
+			0,
+			"The Good Place - S04E07 - Help Is Other People.mkv",
+		},
+	}
+
+	for _, v := range cases {
+		result := v.in.NewFileNameWithOptions("{s} - S{0z}E{0e} - {n}", NamingOptions{MaxLength: v.max})
+
+		if result.NewFileName != v.want {
+			t.Errorf("%+v.NewFileNameWithOptions() with max length %v = %q, expected %q", v.in, v.max, result.NewFileName, v.want)
+		}
+		if v.max > 0 && len(result.NewFileName) > v.max {
+			t.Errorf("%+v.NewFileNameWithOptions() = %q, which is longer than %v bytes", v.in, result.NewFileName, v.max)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"Pokémon", 4, "Pok"},
+		{"Pokémon", 5, "Poké"},
+		{"Pokémon", 100, "Pokémon"},
+		{"ポケモン", 7, "ポケ"},
+		{"Pokémon", 0, ""},
+	}
+
+	for _, v := range cases {
+		result := truncate(v.in, v.n)
+		if result != v.want {
+			t.Errorf("truncate(%q, %v) = %q, expected %q", v.in, v.n, result, v.want)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	cases := []struct {
+		in     string
+		policy SanitizePolicy
+		want   string
+	}{
+		{"What Is Love?", SanitizeWindows, "What Is Love"},
+		{"Trailing Dots...", SanitizeWindows, "Trailing Dots"},
+		{"CON", SanitizeWindows, "CON_"},
+		{"nul.part1", SanitizeWindows, "nul_.part1"},
+		{"Console", SanitizeWindows, "Console"},
+		{"CON", SanitizePosix, "CON"},
+		{"Trailing Dots...", SanitizePosix, "Trailing Dots..."},
+		{" .hidden", SanitizePortable, "hidden"},
+		{"Tab\tName", SanitizePortable, "TabName"},
+		{"..", SanitizePosix, "__"},
+		{".", SanitizePosix, "_"},
+		{"...", SanitizePosix, "..."},
+	}
+
+	for _, v := range cases {
+		result := NamingOptions{Sanitize: v.policy}.sanitize(v.in, true)
+
+		if result != v.want {
+			t.Errorf("sanitize(%q) with %v = %q, expected %q", v.in, v.policy, result, v.want)
+		}
+	}
+}
+
+func TestParseSanitizePolicy(t *testing.T) {
+	cases := []struct {
+		in   string
+		want SanitizePolicy
+	}{
+		{"", SanitizeWindows},
+		{"POSIX", SanitizePosix},
+		{"smb", SanitizePortable},
+		{"portable", SanitizePortable},
+	}
+
+	for _, v := range cases {
+		result, err := ParseSanitizePolicy(v.in)
+		if err != nil || result != v.want {
+			t.Errorf("ParseSanitizePolicy(%q) = %v, %v, expected %v", v.in, result, err, v.want)
+		}
+	}
+
+	if _, err := ParseSanitizePolicy("fat32"); err == nil {
+		t.Errorf("ParseSanitizePolicy(%q) returned no error", "fat32")
+	}
+}
+
+func TestParseReplacements(t *testing.T) {
+	result, err := ParseReplacements([]string{":= -", "&=and"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result[":"] != " -" || result["&"] != "and" {
+		t.Errorf("ParseReplacements() = %q", result)
+	}
+
+	if _, err := ParseReplacements([]string{"nothing"}); err == nil {
+		t.Errorf("ParseReplacements(%q) returned no error", "nothing")
+	}
+}
+
+func TestNamingOptionsValidate(t *testing.T) {
+	cases := []struct {
+		max   int
+		valid bool
+	}{
+		{0, true},
+		{DefaultMaxLength, true},
+		{MinMaxLength, true},
+		{3, false},
+		{-1, false},
+	}
+
+	for _, v := range cases {
+		if err := (NamingOptions{MaxLength: v.max}).Validate(); (err == nil) != v.valid {
+			t.Errorf("NamingOptions{MaxLength: %v}.Validate() == %v, expected valid: %v", v.max, err, v.valid)
+		}
+	}
+}
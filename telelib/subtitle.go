@@ -0,0 +1,83 @@
+package telelib
+
+import (
+	"regexp"
+	"strings"
+)
+
+// subtitleExtensions are the extensions of subtitle files, which are companions rather than episodes in their own
+// right when a video shares their name.
+var subtitleExtensions = []string{"srt", "vtt", "scc", "stl", "sub", "idx", "ssa", "ass", "sup", "txt"}
+
+// subtitleRe matches the extension of a subtitle file, and nothing else within the name.
+var subtitleRe = regexp.MustCompile(`(?i)\.(` + strings.Join(subtitleExtensions, "|") + `)$`)
+
+// subtitleFlags are the tags given to subtitles for who or what they are for, e.g. "Episode.en.sdh.srt".
+var subtitleFlags = []string{"sdh", "forced", "cc", "hi", "default", "full"}
+
+// subtitleLanguages are the ISO 639-1 and 639-2 codes recognised within subtitle file names. Not every language
+// is included, as the more obscure codes are also common words (e.g. "the"). Codes that are still words, such as "it"
+// or "no", are told apart by their case, see isTag.
+var subtitleLanguages = []string{
+	"ar", "bg", "ca", "cs", "cy", "da", "de", "el", "en", "es", "et", "eu", "fa", "fi", "fr", "ga", "gl", "he", "hr",
+	"hu", "id", "is", "it", "ja", "ko", "lt", "lv", "ms", "nb", "nl", "nn", "no", "pl", "pt", "ro", "ru", "sk", "sl",
+	"sr", "sv", "th", "tr", "uk", "vi", "zh",
+	"ara", "baq", "bul", "cat", "ces", "chi", "cze", "dan", "deu", "dut", "ell", "eng", "est", "eus", "fas", "fin",
+	"fra", "fre", "ger", "gle", "glg", "gre", "heb", "hin", "hrv", "hun", "ice", "ind", "isl", "ita", "jpn", "kor",
+	"lav", "lit", "may", "msa", "nld", "nob", "nor", "per", "pol", "por", "ron", "rum", "rus", "slk", "slo", "slv",
+	"spa", "srp", "swe", "tha", "tur", "ukr", "vie", "wel", "zho",
+}
+
+// isSubtitle reports whether a container is a subtitle format.
+func isSubtitle(container string) bool {
+	return contains(subtitleExtensions, container)
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTag reports whether a word is written the way tags are, either all lowercase or all uppercase, e.g. "it" or
+// "HI". Words in episode names are capitalised, so "Show.S01E01.Let.It.srt" and "Show.S01E01.Say.Hi.srt" have no tags.
+func isTag(word string) bool {
+	return word == strings.ToLower(word) || word == strings.ToUpper(word)
+}
+
+// isLanguage reports whether a tag is a language code, optionally with a region, such as "en", "eng" or "pt-BR".
+func isLanguage(tag string) bool {
+	language := strings.FieldsFunc(tag, func(r rune) bool { return r == '-' || r == '_' })
+	if len(language) == 0 || len(language) > 2 {
+		return false
+	}
+	if len(language) == 2 && (len(language[1]) < 2 || len(language[1]) > 4) {
+		return false
+	}
+	return isTag(language[0]) && contains(subtitleLanguages, language[0])
+}
+
+// parseSubtitleTags finds the language and flags at the end of a subtitle's name, e.g. "en" and "sdh" from
+// "Show.S01E01.en.sdh.srt". Flags are joined with ".", in the order they appear. Either may be empty.
+func parseSubtitleTags(fileName string) (language string, flags string) {
+	tags := strings.Split(subtitleRe.ReplaceAllString(fileName, ""), ".")
+
+	var found []string
+	// Tags are read backwards from the extension, stopping at the first thing that isn't one.
+	for i := len(tags) - 1; i > 0; i-- {
+		tag := tags[i]
+		switch {
+		case isTag(tag) && contains(subtitleFlags, tag):
+			found = append([]string{strings.ToLower(tag)}, found...)
+		case language == "" && isLanguage(tag):
+			language = tag
+		default:
+			return language, strings.Join(found, ".")
+		}
+	}
+
+	return language, strings.Join(found, ".")
+}
@@ -0,0 +1,34 @@
+package telelib
+
+import "testing"
+
+func TestParseSubtitleTags(t *testing.T) {
+	cases := []struct {
+		in       string
+		language string
+		flags    string
+	}{
+		{"Show.S01E01.srt", "", ""},
+		{"Show.S01E01.en.srt", "en", ""},
+		{"Show.S01E01.eng.SDH.srt", "eng", "sdh"},
+		{"Show.S01E01.forced.en.srt", "en", "forced"},
+		{"Show.S01E01.en.sdh.forced.srt", "en", "sdh.forced"},
+		{"Show.S01E01.pt_BR.srt", "pt_BR", ""},
+		// Only tags at the end count, and the name itself is never a tag.
+		{"Show.S01E01.Pilot.srt", "", ""},
+		{"en.srt", "", ""},
+		// Codes that are also words count when written as tags, but not as words in the episode name.
+		{"Show.S01E01.it.srt", "it", ""},
+		{"Show.S01E01.no.hi.srt", "no", "hi"},
+		{"Show.S01E01.Say.Hi.srt", "", ""},
+		{"Show.S01E01.Full.srt", "", ""},
+		{"Show.S01E01.Let.It.srt", "", ""},
+	}
+
+	for _, v := range cases {
+		language, flags := parseSubtitleTags(v.in)
+		if language != v.language || flags != v.flags {
+			t.Errorf("parseSubtitleTags(%q) = %q, %q, want %q, %q", v.in, language, flags, v.language, v.flags)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package telelib
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization is the Unicode normalization form series and episode names are converted to.
+type Normalization string
+
+const (
+	// NormalizeNone leaves names exactly as the provider returned them.
+	NormalizeNone Normalization = ""
+	// NormalizeNFC composes characters, so "é" is a single code point. Expected by Windows and Linux.
+	NormalizeNFC Normalization = "nfc"
+	// NormalizeNFD decomposes characters, so "é" is an "e" followed by a combining accent. Expected by older macOS.
+	NormalizeNFD Normalization = "nfd"
+)
+
+// Normalizations lists the names accepted by ParseNormalization.
+var Normalizations = []string{"none", string(NormalizeNFC), string(NormalizeNFD)}
+
+// ParseNormalization retrieves a normalization form from its name.
+func ParseNormalization(name string) (Normalization, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return NormalizeNone, nil
+	case string(NormalizeNFC):
+		return NormalizeNFC, nil
+	case string(NormalizeNFD):
+		return NormalizeNFD, nil
+	}
+
+	return "", fmt.Errorf("unknown normalization %q, expected one of %v", name, Normalizations)
+}
+
+// asciiReplacements covers letters that don't decompose into an ASCII letter and an accent.
+var asciiReplacements = strings.NewReplacer(
+	"ß", "ss", "Æ", "AE", "æ", "ae", "Œ", "OE", "œ", "oe", "Ø", "O", "ø", "o",
+	"Ł", "L", "ł", "l", "Đ", "D", "đ", "d", "Þ", "Th", "þ", "th", "ı", "i",
+	"‘", "'", "’", "'", "“", `"`, "”", `"`, "–", "-", "—", "-", "…", "...",
+)
+
+// normalize converts a series or episode name to the configured normalization form, and to ASCII if transliterating.
+func (opts NamingOptions) normalize(name string) string {
+	if opts.Transliterate {
+		if ascii, ok := transliterate(name); ok {
+			return ascii
+		}
+	}
+
+	switch opts.Normalize {
+	case NormalizeNFC:
+		return norm.NFC.String(name)
+	case NormalizeNFD:
+		return norm.NFD.String(name)
+	}
+
+	return name
+}
+
+// transliterate converts a name to ASCII, e.g. "Pokémon" to "Pokemon".
+// Characters with no ASCII equivalent are removed. Returns false if that would remove most of the name's letters and
+// numbers, e.g. for names in Japanese, so that the name can be kept as it is rather than left empty.
+func transliterate(name string) (string, bool) {
+	// Decomposing separates accents from their letters, so they can be removed.
+	stripAccents := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	ascii, _, err := transform.String(stripAccents, name)
+	if err != nil {
+		return name, false
+	}
+
+	ascii = asciiReplacements.Replace(ascii)
+	ascii = strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII {
+			return -1
+		}
+		return r
+	}, ascii)
+
+	return ascii, 2*alphanumerics(ascii) >= alphanumerics(name)
+}
+
+// alphanumerics counts the letters and numbers within a name.
+func alphanumerics(name string) int {
+	count := 0
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,79 @@
+package telelib
+
+import (
+	"testing"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestNormalize(t *testing.T) {
+	// "Pokémon" with "é" as a single code point, and as an "e" followed by a combining accent.
+	composed := "Pokémon"
+	decomposed := "Pokémon"
+
+	cases := []struct {
+		in   string
+		opts NamingOptions
+		want string
+	}{
+		{decomposed, NamingOptions{}, decomposed},
+		{decomposed, NamingOptions{Normalize: NormalizeNFC}, composed},
+		{composed, NamingOptions{Normalize: NormalizeNFD}, decomposed},
+		{composed, NamingOptions{Transliterate: true}, "Pokemon"},
+		{decomposed, NamingOptions{Transliterate: true}, "Pokemon"},
+		{"Æon Flux – Straße", NamingOptions{Transliterate: true}, "AEon Flux - Strasse"},
+		{"Pokémon ポケモン", NamingOptions{Transliterate: true}, "Pokemon "},
+		// Names that would lose most of their letters are kept as they are, and normalized instead.
+		{"ポケモン", NamingOptions{Transliterate: true}, "ポケモン"},
+		{"ポケモン", NamingOptions{Transliterate: true, Normalize: NormalizeNFD}, norm.NFD.String("ポケモン")},
+	}
+
+	for _, v := range cases {
+		result := v.opts.normalize(v.in)
+		if result != v.want {
+			t.Errorf("normalize(%q) with %+v = %q, expected %q", v.in, v.opts, result, v.want)
+		}
+	}
+}
+
+func TestNewFileNameTransliterate(t *testing.T) {
+	in := ParsedFileInfo{Container: "mkv", Series: "Pokémon", Season: 1, Episode: 1, EpisodeName: "Pokémon - I Choose You!"}
+
+	result := in.NewFileNameWithOptions("{s} - S{0z}E{0e} - {n}", NamingOptions{Transliterate: true})
+	if result.NewFileName != "Pokemon - S01E01 - Pokemon - I Choose You!.mkv" {
+		t.Errorf("%+v.NewFileNameWithOptions() = %q", in, result.NewFileName)
+	}
+}
+
+func TestNewFileNameTransliterateFallback(t *testing.T) {
+	in := ParsedFileInfo{Container: "mkv", Series: "ポケモン", Season: 1, Episode: 1, EpisodeName: "ピカチュウ"}
+
+	// Transliterating would leave nothing of either name.
+	result := in.NewFileNameWithOptions("{s} - S{0z}E{0e} - {n}", NamingOptions{Transliterate: true})
+	if result.NewFileName != "ポケモン - S01E01 - ピカチュウ.mkv" {
+		t.Errorf("%+v.NewFileNameWithOptions() = %q", in, result.NewFileName)
+	}
+}
+
+func TestParseNormalization(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Normalization
+	}{
+		{"", NormalizeNone},
+		{"none", NormalizeNone},
+		{"NFC", NormalizeNFC},
+		{"nfd", NormalizeNFD},
+	}
+
+	for _, v := range cases {
+		result, err := ParseNormalization(v.in)
+		if err != nil || result != v.want {
+			t.Errorf("ParseNormalization(%q) = %v, %v, expected %v", v.in, result, err, v.want)
+		}
+	}
+
+	if _, err := ParseNormalization("nfkc"); err == nil {
+		t.Errorf("ParseNormalization(%q) returned no error", "nfkc")
+	}
+}
@@ -0,0 +1,102 @@
+package telelib
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// WalkOptions changes which files WalkFiles finds.
+type WalkOptions struct {
+	// MaxDepth is how many folders deep to look, e.g. 1 looks in the folders directly within the directory, but not
+	// the folders within those. 0 has no limit.
+	MaxDepth int
+	// Exclude skips files and folders matching any of these globs (see path.Match), e.g. "Extras" or "*.part".
+	// Globs are matched against both the name, and the path relative to the directory, using "/" between folders.
+	Exclude []string
+}
+
+// WalkFiles retrieves a list of files from a directory and every folder within it, as paths joined onto the
+// directory. Files are listed folder by folder, in lexical order.
+func WalkFiles(directory string, opts WalkOptions) ([]string, error) {
+	if err := validateGlobs(opts.Exclude); err != nil {
+		return nil, err
+	}
+
+	var fileList []string
+	err := fsutil.Walk(directory, func(fileName string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fileName == directory {
+			return nil
+		}
+
+		rel, err := filepath.Rel(directory, fileName)
+		if err != nil {
+			return err
+		}
+
+		if opts.excluded(rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			// Folders deeper than the maximum depth are skipped, along with everything within them.
+			if opts.MaxDepth > 0 && depth(rel) > opts.MaxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		fileList = append(fileList, fileName)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking dir in walkfiles %v", err)
+	}
+
+	return fileList, nil
+}
+
+// excluded reports whether a path, relative to the directory being walked, matches any exclude glob.
+func (opts WalkOptions) excluded(rel string) bool {
+	return matchesGlob(opts.Exclude, rel) != ""
+}
+
+// validateGlobs checks every exclude glob can be matched against.
+func validateGlobs(patterns []string) error {
+	for _, v := range patterns {
+		if _, err := path.Match(v, ""); err != nil {
+			return fmt.Errorf("invalid exclude glob %q: %v", v, err)
+		}
+	}
+	return nil
+}
+
+// matchesGlob returns the first glob that matches either the name or the path of a file, using "/" between folders,
+// or "" if none do.
+func matchesGlob(patterns []string, fileName string) string {
+	for _, v := range patterns {
+		if matched, _ := path.Match(v, filepath.Base(fileName)); matched {
+			return v
+		}
+		if matched, _ := path.Match(v, filepath.ToSlash(fileName)); matched {
+			return v
+		}
+	}
+	return ""
+}
+
+// depth is how many folders deep a relative path is, e.g. 1 for "Season 1".
+func depth(rel string) int {
+	count := 1
+	for dir := filepath.Dir(rel); dir != "."; dir = filepath.Dir(dir) {
+		count++
+	}
+	return count
+}
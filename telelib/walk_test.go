@@ -0,0 +1,82 @@
+package telelib
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+)
+
+func TestWalkFiles(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fsutil = &afero.Afero{Fs: fs}
+
+	for _, v := range []string{
+		"shows/a.mkv",
+		"shows/Season 1/b.mkv",
+		"shows/Season 1/Extras/c.mkv",
+		"shows/Season 2/d.mkv",
+		"shows/Season 2/d.mkv.part",
+		"shows/Season 2/Deep/Deeper/e.mkv",
+	} {
+		afero.WriteFile(fs, filepath.FromSlash(v), []byte("random contents"), 0644)
+	}
+
+	cases := []struct {
+		opts WalkOptions
+		want []string
+	}{
+		{
+			WalkOptions{},
+			[]string{"shows/Season 1/Extras/c.mkv", "shows/Season 1/b.mkv", "shows/Season 2/Deep/Deeper/e.mkv", "shows/Season 2/d.mkv", "shows/Season 2/d.mkv.part", "shows/a.mkv"},
+		},
+		{
+			WalkOptions{MaxDepth: 1},
+			[]string{"shows/Season 1/b.mkv", "shows/Season 2/d.mkv", "shows/Season 2/d.mkv.part", "shows/a.mkv"},
+		},
+		{
+			WalkOptions{Exclude: []string{"Extras", "*.part", "Season 2/Deep"}},
+			[]string{"shows/Season 1/b.mkv", "shows/Season 2/d.mkv", "shows/a.mkv"},
+		},
+	}
+
+	for _, v := range cases {
+		result, err := WalkFiles("shows", v.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var want []string
+		for _, file := range v.want {
+			want = append(want, filepath.FromSlash(file))
+		}
+		if !cmp.Equal(result, want) {
+			t.Errorf("WalkFiles(%q, %+v) == %q, expected %q", "shows", v.opts, result, want)
+		}
+	}
+
+	if _, err := WalkFiles("shows", WalkOptions{Exclude: []string{"["}}); err == nil {
+		t.Errorf("WalkFiles() accepted an invalid exclude glob")
+	}
+}
+
+func TestNewFileNameBaseDir(t *testing.T) {
+	p := ParsedFileInfo{FileName: filepath.FromSlash("shows/Season 1/the.good.place.s01e01.mkv"), Container: "mkv", Series: "The Good Place", Season: 1, Episode: 1, EpisodeName: "Everything Is Fine"}
+	opts := NamingOptions{BaseDir: "shows"}
+
+	cases := []struct {
+		format string
+		want   string
+	}{
+		{"{s}/Season {0z}/{s} - S{0z}E{0e} - {n}", "shows/The Good Place/Season 01/The Good Place - S01E01 - Everything Is Fine.mkv"},
+		// Without folders, files stay where they are.
+		{"{s} - S{0z}E{0e} - {n}", "shows/Season 1/The Good Place - S01E01 - Everything Is Fine.mkv"},
+	}
+
+	for _, v := range cases {
+		if result := p.NewFileNameWithOptions(v.format, opts); result.NewFileName != filepath.FromSlash(v.want) {
+			t.Errorf("NewFileNameWithOptions(%q) = %q, expected %q", v.format, result.NewFileName, filepath.FromSlash(v.want))
+		}
+	}
+}